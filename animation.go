@@ -0,0 +1,231 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"mandelbrot/video"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Easing maps animation time in range [0, 1] to progress in range [0, 1]
+type Easing func(t float64) float64
+
+func easeNone(t float64) float64 {
+	return t
+}
+
+func easeIn(t float64) float64 {
+	return t * t
+}
+
+func easeOut(t float64) float64 {
+	return t * (2 - t)
+}
+
+func easeInOut(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+func parseEasing(name string) (Easing, error) {
+	switch name {
+	case "none":
+		return easeNone, nil
+	case "in":
+		return easeIn, nil
+	case "out":
+		return easeOut, nil
+	case "inout":
+		return easeInOut, nil
+	default:
+		return nil, fmt.Errorf("unknown easing: %s", name)
+	}
+}
+
+// Binary logarithm of a positive number of any magnitude
+func log2Big(x *big.Float) float64 {
+	mant := big.NewFloat(0)
+	exp := x.MantExp(mant)
+	m, _ := mant.Float64()
+
+	return float64(exp) + math.Log2(m)
+}
+
+// x * 2^power computed without losing precision of x
+func mulExp2Big(x *big.Float, power float64) *big.Float {
+	whole := math.Floor(power)
+
+	ret := big.NewFloat(math.Exp2(power - whole)).SetPrec(x.Prec())
+	ret.Mul(ret, x)
+
+	return ret.SetMantExp(ret, int(whole))
+}
+
+// a + (b - a) * t
+func lerpBig(a, b *big.Float, t float64) *big.Float {
+	ret := big.NewFloat(0).SetPrec(a.Prec()).Sub(b, a)
+	ret.Mul(ret, big.NewFloat(t))
+
+	return ret.Add(ret, a)
+}
+
+// Check that frame file pattern has a number verb like frame_%05d.png
+func checkFramePattern(pattern string) error {
+	if !strings.Contains(pattern, "%") || fmt.Sprintf(pattern, 0) == fmt.Sprintf(pattern, 1) {
+		return fmt.Errorf("frame pattern must contain frame number like %%05d: %s", pattern)
+	}
+
+	return nil
+}
+
+const DefaultFPS = 30
+
+// frameOptions select where and how animation frames are stored
+type frameOptions struct {
+	Output     string  `json:"output"`      // Frame files pattern, video file or "-"
+	FPS        float64 `json:"fps"`         // Frames per second of videos
+	StartFrame int     `json:"start_frame"` // Frames before it are not rendered
+	Force      bool    `json:"force"`       // Render frames even if files exist
+	Quality    int     `json:"quality"`     // JPEG quality
+}
+
+func newFrameOptions() frameOptions {
+	return frameOptions{
+		Output:  "frame_%05d.png",
+		FPS:     DefaultFPS,
+		Quality: DefaultJPEGQuality,
+	}
+}
+
+// Register options in the flag set, current values are used as defaults
+func (o *frameOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.Output, "o", o.Output, "frame files pattern, .y4m or .avi video file, - to stream YUV4MPEG2 to stdout")
+	fs.Float64Var(&o.FPS, "fps", o.FPS, "frames per second of video output")
+	fs.IntVar(&o.StartFrame, "start-frame", o.StartFrame, "resume rendering of frame files from the frame")
+	fs.BoolVar(&o.Force, "force", o.Force, "render frames even if files exist")
+	fs.IntVar(&o.Quality, "quality", o.Quality, "JPEG quality of frame files and AVI video, 1-100")
+}
+
+// frameWriter stores rendered animation frames
+type frameWriter interface {
+	// Done reports whether the frame is stored by a previous run
+	Done(frame int) bool
+
+	WriteFrame(frame int, img image.Image) error
+
+	Close() error
+}
+
+// imageSequence writes every frame into a numbered image file
+type imageSequence struct {
+	pattern       string
+	width, height int
+	quality       int
+}
+
+func (s *imageSequence) Done(frame int) bool {
+	return imageComplete(fmt.Sprintf(s.pattern, frame), s.width, s.height)
+}
+
+func (s *imageSequence) WriteFrame(frame int, img image.Image) error {
+	return writeImage(fmt.Sprintf(s.pattern, frame), img, "", s.quality)
+}
+
+func (s *imageSequence) Close() error {
+	return nil
+}
+
+// videoFrames streams frames into a video, frames must come in order
+type videoFrames struct {
+	w video.Writer
+}
+
+func (v *videoFrames) Done(int) bool {
+	return false
+}
+
+func (v *videoFrames) WriteFrame(_ int, img image.Image) error {
+	return v.w.WriteFrame(img)
+}
+
+func (v *videoFrames) Close() error {
+	return v.w.Close()
+}
+
+func (o *frameOptions) newWriter(width, height int) (frameWriter, error) {
+	if o.Output == "-" || video.IsVideoPath(o.Output) {
+		// a video is written from its first frame, earlier frames can't be kept from a previous run
+		if o.StartFrame > 0 {
+			return nil, errors.New("-start-frame is not supported by video output, render frame files to resume")
+		}
+
+		if o.Output != "-" {
+			if err := os.MkdirAll(filepath.Dir(o.Output), 0755); err != nil {
+				return nil, errors.Wrap(err, "create output directory")
+			}
+		}
+
+		w, err := video.Create(o.Output, width, height, o.FPS, o.Quality)
+		if err != nil {
+			return nil, err
+		}
+
+		return &videoFrames{w: w}, nil
+	}
+
+	if err := checkFramePattern(o.Output); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fmt.Sprintf(o.Output, 0)), 0755); err != nil {
+		return nil, errors.Wrap(err, "create output directory")
+	}
+
+	return &imageSequence{pattern: o.Output, width: width, height: height, quality: o.Quality}, nil
+}
+
+// Render frames and store them one by one as they are ready.
+// Frames stored by a previous run are skipped unless forced
+func (o *frameOptions) writeFrames(width, height, frames int, render func(frame int) (*image.RGBA, error)) error {
+	w, err := o.newWriter(width, height)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	rendered := 0
+	for frame := o.StartFrame; frame < frames; frame++ {
+		if !o.Force && w.Done(frame) {
+			_, _ = fmt.Fprintf(os.Stderr, "[%d/%d] skipped\n", frame+1, frames)
+			continue
+		}
+
+		frameStarted := time.Now()
+		img, err := render(frame)
+		if err == nil {
+			err = w.WriteFrame(frame, img)
+		}
+		if err != nil {
+			w.Close()
+			return errors.Wrapf(err, "frame %d", frame)
+		}
+
+		_, _ = fmt.Fprintf(os.Stderr, "[%d/%d] done in %s\n", frame+1, frames, time.Since(frameStarted).Round(time.Millisecond))
+		rendered++
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Rendered %d frames in %s\n", rendered, time.Since(started).Round(time.Millisecond))
+
+	return nil
+}
@@ -6,9 +6,15 @@ import (
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/go-gl/mathgl/mgl32"
 	"image"
+	"image/color"
 	"log"
+	"mandelbrot/coloring"
+	"mandelbrot/fieldcache"
 	"mandelbrot/fractal"
+	"mandelbrot/fractal/mandelbrot"
 	"mandelbrot/graph"
+	"mandelbrot/palette"
+	"math"
 	"runtime"
 	"sync"
 	"time"
@@ -29,6 +35,7 @@ type Application struct {
 	renderer *graph.Renderer
 
 	fractalObject  *graph.Object2D // Simple textured rectangle. Fractal will be rendered here
+	fractalField   *fractal.Field  // Collected orbits of every pixel, filled by the generator
 	fractalImg     *image.RGBA     // The image object where fractal will be drawn
 	fractalTexture *graph.Texture  // OpenGL texture which will be rendered on an fractalObject
 	shader         *graph.Shader   // The main shader
@@ -37,15 +44,63 @@ type Application struct {
 
 	generating bool // is generating in progress
 
+	fieldCache *fieldcache.Cache // Generated fields of visited views, nil when caching is disabled
+
+	generatorName string // Generator settings saved in bookmarks
+	iterations    int
+
+	// Generator settings selected by UseGenerator, bookmarks without generator settings return to them
+	defaultGeneratorName string
+	defaultIterations    int
+
+	bookmarks     *BookmarkStore // Nil when bookmarks are not available
+	bookmarkIndex int            // Bookmark shown last, -1 before any
+
+	exportPath string // Location file of another explorer written by E key, empty if not set
+
 	cursorPos struct {
 		x  float64
 		y  float64
 	}
 
-	generator fractal.Generator // Current fractal generator
-	zoomer    Zoomer
+	// GPU colorizing: palette positions of pixels are uploaded as a float texture
+	// and the fragment shader looks them up in the palette texture
+	gpu struct {
+		enabled bool
+		density float32 // How many times the palette repeats over positions range
+		mode    palette.Mode
+		palette color.Palette // Single period of the palette, the shader repeats it by density and mode
+	}
+
+	positions        []float32       // Palette positions of every pixel
+	positionsTexture *graph.Texture  // Float texture of palette positions
+	positionsObject  *graph.Object2D // Rectangle rendered with the palette shader
+	paletteTexture   *graph.Texture  // 1D texture of palette colors
+	paletteShader    *graph.Shader   // Maps palette positions to colors
+
+	// Palette cycling rotates palette offset over time without regenerating the fractal
+	cycling struct {
+		enabled  bool
+		speed    float64 // Palette cycles per second, negative values reverse the direction
+		offset   float64
+		lastTick time.Time
+	}
+
+	generator   fractal.Generator   // Current fractal generator
+	colorizer   *coloring.Colorizer // Converts collected orbits into colors
+	colorBuffer coloring.Buffer     // Memory of colorizing on CPU, reused by every recolored frame
+	zoomer      Zoomer
 }
 
+const (
+	DefaultCycleSpeed     = 0.1  // Palette cycles per second
+	cycleSpeedAdjustRatio = 1.5  // Speed change on a key press
+	minCycleSpeed         = 0.01 // Slower cycling stops, speeding up starts from it
+
+	DefaultGPUDensity     = 1.0  // Palette repeats when colorizing on GPU
+	gpuDensityAdjustRatio = 1.25 // Density change on a key press
+)
+
 func NewApplication(windowTitle string) *Application {
 	state := NewState()
 
@@ -53,6 +108,10 @@ func NewApplication(windowTitle string) *Application {
 		windowTitle: windowTitle,
 		state:       state,
 	}
+	ret.cycling.speed = DefaultCycleSpeed
+	ret.gpu.density = DefaultGPUDensity
+	ret.gpu.mode = palette.ModeRepeat
+	ret.bookmarkIndex = -1
 
 	return ret
 }
@@ -119,7 +178,19 @@ func (a *Application) RegenerateFractal() {
 		}
 	}
 
+	if rotator, ok := a.generator.(fractal.Rotator); ok {
+		rotator.SetRotation(a.state.GetRotation())
+	}
+
+	opts := a.colorizer.Options()
+	key := ""
+	if a.fieldCache != nil {
+		key = fieldCacheKey(a.generator, a.state, opts, a.fractalField)
+	}
+
 	done := func() {
+		storeCachedField(a.fieldCache, key, a.generator, a.state, opts, a.fractalField)
+
 		a.scheduleRefreshTexture()
 		a.stopGenerating()
 
@@ -128,29 +199,258 @@ func (a *Application) RegenerateFractal() {
 		fmt.Printf("Generation time: %s\n", genTime)
 	}
 
+	if key != "" && a.fieldCache.Get(key, a.fractalField) {
+		fmt.Println("Field is loaded from cache")
+		a.scheduleRefreshTexture()
+		a.stopGenerating()
+		return
+	}
+
 	a.generator.Generate(
-		a.fractalImg,
+		a.fractalField,
 		a.state.GetCX(),
 		a.state.GetCY(),
 		a.state.GetScale(),
 		a.state.GetPhysicalWidth(),
 		a.state.GetPhysicalHeight(),
+		opts,
 		progress,
 		done,
 	)
 }
 
+// SetFieldCache sets cache of generated fields, nil disables caching
+func (a *Application) SetFieldCache(cache *fieldcache.Cache) {
+	a.fieldCache = cache
+}
+
+// UseGenerator creates generator by name, 0 iterations selects the default limit
+func (a *Application) UseGenerator(name string, iterations int) error {
+	if iterations <= 0 {
+		iterations = mandelbrot.DefaultIterations
+	}
+
+	generator, err := newGenerator(name, iterations)
+	if err != nil {
+		return err
+	}
+
+	a.SetGenerator(generator)
+
+	a.Lock()
+	a.generatorName = name
+	a.iterations = iterations
+	a.defaultGeneratorName = name
+	a.defaultIterations = iterations
+	a.Unlock()
+
+	return nil
+}
+
+// SetState replaces the view, screen size of the state must match the window
+func (a *Application) SetState(state *State) {
+	a.Lock()
+	a.state = state
+	a.Unlock()
+}
+
+// SetExportPath sets location file written by E key, format is selected by the extension
+func (a *Application) SetExportPath(path string) {
+	a.Lock()
+	a.exportPath = path
+	a.Unlock()
+}
+
+// Write current view to the export location file
+func (a *Application) exportLocation() {
+	a.Lock()
+	path, iterations := a.exportPath, a.iterations
+	state := a.state.Copy()
+	a.Unlock()
+
+	if path == "" {
+		fmt.Println("Export file is not set, use -export")
+		return
+	}
+
+	if err := exportState(path, state, "", iterations); err != nil {
+		log.Println(err)
+		return
+	}
+
+	fmt.Printf("Location is exported to %s\n", path)
+}
+
+// SetBookmarks sets the store of bookmarks saved and cycled by keys
+func (a *Application) SetBookmarks(store *BookmarkStore) {
+	a.Lock()
+	a.bookmarks = store
+	a.Unlock()
+}
+
+// Save current view as a new bookmark named by the time
+func (a *Application) saveBookmark() {
+	if a.bookmarks == nil || a.isGenerating() {
+		return
+	}
+
+	name := time.Now().Format("2006-01-02 15:04:05")
+	a.Lock()
+	bookmark := NewBookmark(name, a.state, a.generatorName, a.iterations)
+	a.Unlock()
+
+	if err := a.bookmarks.Save(bookmark); err != nil {
+		log.Println(err)
+		return
+	}
+
+	fmt.Printf("Bookmark %q is saved\n", name)
+}
+
+// Jump to the bookmark offset from the current one, bookmarks are cycled around
+func (a *Application) cycleBookmark(offset int) {
+	if a.bookmarks == nil || a.isGenerating() {
+		return
+	}
+
+	bookmarks := a.bookmarks.GetBookmarks()
+	index := ((a.bookmarkIndex+offset)%len(bookmarks) + len(bookmarks)) % len(bookmarks)
+	if a.bookmarkIndex < 0 && offset < 0 {
+		index = len(bookmarks) - 1
+	}
+
+	if err := a.GoToBookmark(bookmarks[index]); err != nil {
+		log.Println(err)
+		return
+	}
+	a.bookmarkIndex = index
+
+	a.RegenerateFractal()
+}
+
+// GoToBookmark moves the view to the bookmark. Generator is switched to the one of the bookmark,
+// bookmarks without generator settings use the generator selected by UseGenerator
+func (a *Application) GoToBookmark(b Bookmark) error {
+	a.Lock()
+	name, iterations := a.defaultGeneratorName, a.defaultIterations
+	a.Unlock()
+
+	if b.Generator != "" {
+		name = b.Generator
+	}
+	if b.Iterations > 0 {
+		iterations = b.Iterations
+	}
+	generator, err := newGenerator(name, iterations)
+	if err != nil {
+		return err
+	}
+
+	// invalid bookmark leaves the view unchanged
+	if err := b.Apply(a.state); err != nil {
+		return err
+	}
+
+	a.Lock()
+	a.generator = generator
+	a.generatorName = name
+	a.iterations = iterations
+	a.Unlock()
+
+	fmt.Printf("Bookmark %q\n", b.Name)
+
+	return nil
+}
+
 func (a *Application) SetGenerator(generator fractal.Generator) {
 	a.Lock()
 	a.generator = generator
 	a.Unlock()
 }
 
+func (a *Application) SetColorizer(colorizer *coloring.Colorizer) {
+	a.Lock()
+	a.colorizer = colorizer
+	a.Unlock()
+}
+
+// SetGPUColorizing enables palette mapping in the fragment shader.
+// density is how many times the palette repeats, mode defines how positions outside of the palette are handled.
+// The shader applies them to pal, so it must not be repeated or mirrored itself.
+// Nil pal uses the colorizer palette
+func (a *Application) SetGPUColorizing(enabled bool, density float32, mode palette.Mode, pal color.Palette) {
+	a.Lock()
+	a.gpu.enabled = enabled
+	a.gpu.density = density
+	a.gpu.mode = mode
+	a.gpu.palette = pal
+	a.Unlock()
+}
+
+// Colorizing on GPU is used when enabled and there are no shadings and layers,
+// they are applied on CPU only
+func (a *Application) useGPU() bool {
+	a.Lock()
+	defer a.Unlock()
+	return a.gpu.enabled && a.gpuSupported()
+}
+
+func (a *Application) gpuSupported() bool {
+	return len(a.colorizer.GetShadings()) == 0 && a.colorizer.GetLayersCount() == 0
+}
+
+// Set palette shader uniforms of the current frame
+func (a *Application) setPaletteUniforms() {
+	a.Lock()
+	defer a.Unlock()
+
+	insideColor := a.colorizer.PaletteRGBA()[:4]
+
+	a.paletteShader.Bind()
+	a.paletteShader.SetUniform1i("u_Palette", 1)
+	a.paletteShader.SetUniform1f("u_Offset", float32(a.cycling.offset))
+	a.paletteShader.SetUniform1f("u_Density", a.gpu.density)
+	a.paletteShader.SetUniform1i("u_Mode", int32(a.gpu.mode))
+	a.paletteShader.SetUniform4f("u_InsideColor",
+		float32(insideColor[0])/255, float32(insideColor[1])/255, float32(insideColor[2])/255, float32(insideColor[3])/255)
+}
+
+// SetCycleSpeed sets palette cycling speed in cycles per second
+func (a *Application) SetCycleSpeed(speed float64) {
+	a.Lock()
+	a.cycling.speed = speed
+	a.Unlock()
+}
+
+// Advance palette offset if cycling is enabled. Returns true if the offset has changed
+func (a *Application) updateCycling() bool {
+	a.Lock()
+	defer a.Unlock()
+
+	if !a.cycling.enabled {
+		return false
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(a.cycling.lastTick).Seconds()
+	a.cycling.lastTick = now
+
+	a.cycling.offset += a.cycling.speed * elapsed
+	a.cycling.offset -= math.Floor(a.cycling.offset)
+	a.colorizer.SetOffset(a.cycling.offset)
+
+	return true
+}
+
 func (a *Application) Run() {
 	if a.generator == nil {
 		panic("generator not set")
 	}
 
+	if a.colorizer == nil {
+		panic("colorizer not set")
+	}
+
 	a.Start()
 
 	var fps graph.FPS
@@ -166,17 +466,37 @@ func (a *Application) Run() {
 	}()
 
 	for !a.window.ShouldClose() {
-		// Refresh GL texture from buffer if requested to do so
-		if a.needRefreshTexture() {
-			a.fractalTexture.SetImageData(a.fractalImg.Pix)
-			a.clearRefreshTexture()
-		}
+		cycled := a.updateCycling()
 
 		// Clear scene
 		a.renderer.Clear()
 
-		// Render fractal
-		a.renderer.Draw(a.fractalObject, 0, 0)
+		if a.useGPU() {
+			// Only palette positions are uploaded, palette offset is a shader uniform,
+			// so palette cycling doesn't need any texture updates
+			if a.needRefreshTexture() {
+				a.colorizer.Positions(a.fractalField, a.positions)
+				a.positionsTexture.SetFloatData(a.positions)
+				a.clearRefreshTexture()
+			}
+
+			a.setPaletteUniforms()
+			a.paletteTexture.Bind(1)
+
+			// Render fractal
+			a.renderer.Draw(a.positionsObject, 0, 0)
+		} else {
+			// Refresh GL texture from buffer if requested to do so.
+			// Palette cycling only recolors already generated orbits
+			if a.needRefreshTexture() || cycled {
+				a.colorizer.ColorizeBuffer(a.fractalField, a.fractalImg, &a.colorBuffer)
+				a.fractalTexture.SetImageData(a.fractalImg.Pix)
+				a.clearRefreshTexture()
+			}
+
+			// Render fractal
+			a.renderer.Draw(a.fractalObject, 0, 0)
+		}
 
 		a.window.SwapBuffers()
 		glfw.PollEvents()
@@ -211,6 +531,7 @@ func (a *Application) Start() {
 	a.window.MakeContextCurrent()
 	a.window.SetMouseButtonCallback(a.MouseButtonCallback)
 	a.window.SetCursorPosCallback(a.CursorPosCallback)
+	a.window.SetKeyCallback(a.KeyCallback)
 
 	glfw.SwapInterval(1)
 
@@ -236,7 +557,10 @@ func (a *Application) Start() {
 	a.shader.Bind()
 	a.shader.SetUniformMat4f("u_MVP", proj)
 
-	// Create image buffer, the target for a fractal generating functions
+	// Create orbits buffer, the target for a fractal generating functions
+	a.fractalField = fractal.NewField(int(a.state.GetScreenWidth()), int(a.state.GetScreenHeight()))
+
+	// Create image buffer, collected orbits are colorized here
 	a.fractalImg = image.NewRGBA(image.Rectangle{
 		Min: image.Point{X: 0, Y: 0},
 		Max: image.Point{X: int(a.state.GetScreenWidth()), Y: int(a.state.GetScreenHeight())},
@@ -246,19 +570,36 @@ func (a *Application) Start() {
 	a.fractalTexture = graph.NewTexture(int(a.state.GetScreenWidth()), int(a.state.GetScreenHeight()))
 
 	// Create fractal render object
-	a.fractalObject, err = graph.NewObject2d(a.shader, a.fractalTexture)
+	a.fractalObject, err = a.newScreenObject(a.shader, a.fractalTexture)
 	if err != nil {
 		panic(err)
 	}
 
-	a.fractalObject.AddVertex(mgl32.Vec2{0, 0}, mgl32.Vec2{0.0, 0.0})
-	a.fractalObject.AddVertex(mgl32.Vec2{float32(a.state.GetScreenWidth()), 0}, mgl32.Vec2{1.0, 0.0})
-	a.fractalObject.AddVertex(mgl32.Vec2{float32(a.state.GetScreenWidth()), float32(a.state.GetScreenHeight())}, mgl32.Vec2{1.0, 1.0})
-	a.fractalObject.AddVertex(mgl32.Vec2{0, float32(a.state.GetScreenHeight())}, mgl32.Vec2{0.0, 1.0})
-	a.fractalObject.AddIndexBufferData(0, 1, 2)
-	a.fractalObject.AddIndexBufferData(2, 3, 0)
+	// Load palette shader and create textures for colorizing on GPU
+	a.paletteShader, err = graph.NewShader("res/palette.shader")
+	if err != nil {
+		panic(err)
+	}
+	a.paletteShader.Bind()
+	a.paletteShader.SetUniformMat4f("u_MVP", proj)
 
-	err = a.fractalObject.Compile()
+	a.positions = make([]float32, len(a.fractalField.Orbits))
+
+	// Interpolating positions of neighbour pixels would mix colors of escaped and inner points
+	a.positionsTexture = graph.NewTextureFormat(int(a.state.GetScreenWidth()), int(a.state.GetScreenHeight()), graph.TextureFormatR32F)
+	a.positionsTexture.SetFilter(gl.NEAREST)
+
+	// the shader wraps palette positions itself, neighbour colors are not interpolated like on CPU
+	gpuPalette := a.gpu.palette
+	if gpuPalette == nil {
+		gpuPalette = a.colorizer.GetPalette()
+	}
+	a.paletteTexture = graph.NewTexture1D(len(gpuPalette), graph.TextureFormatRGBA8)
+	a.paletteTexture.SetFilter(gl.NEAREST)
+	a.paletteTexture.SetWrap(gl.CLAMP_TO_EDGE)
+	a.paletteTexture.SetImageData(coloring.PaletteRGBA(gpuPalette))
+
+	a.positionsObject, err = a.newScreenObject(a.paletteShader, a.positionsTexture)
 	if err != nil {
 		panic(err)
 	}
@@ -271,10 +612,36 @@ func (a *Application) Start() {
 	a.RegenerateFractal()
 }
 
+// Create a rectangle covering the whole window
+func (a *Application) newScreenObject(shader *graph.Shader, texture *graph.Texture) (*graph.Object2D, error) {
+	ret, err := graph.NewObject2d(shader, texture)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.AddVertex(mgl32.Vec2{0, 0}, mgl32.Vec2{0.0, 0.0})
+	ret.AddVertex(mgl32.Vec2{float32(a.state.GetScreenWidth()), 0}, mgl32.Vec2{1.0, 0.0})
+	ret.AddVertex(mgl32.Vec2{float32(a.state.GetScreenWidth()), float32(a.state.GetScreenHeight())}, mgl32.Vec2{1.0, 1.0})
+	ret.AddVertex(mgl32.Vec2{0, float32(a.state.GetScreenHeight())}, mgl32.Vec2{0.0, 1.0})
+	ret.AddIndexBufferData(0, 1, 2)
+	ret.AddIndexBufferData(2, 3, 0)
+
+	err = ret.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
 func (a *Application) Terminate() {
 	a.fractalObject.Destroy()
 	a.fractalTexture.Destroy()
 	a.shader.Destroy()
+	a.positionsObject.Destroy()
+	a.positionsTexture.Destroy()
+	a.paletteTexture.Destroy()
+	a.paletteShader.Destroy()
 }
 
 func (a *Application) MouseButtonCallback(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
@@ -294,6 +661,74 @@ func (a *Application) CursorPosCallback(w *glfw.Window, xpos float64, ypos float
 	a.Unlock()
 }
 
+// Keyboard controls: C toggles palette cycling, R reverses its direction,
+// +/- speed it up or slow it down. G toggles colorizing on GPU,
+// [/] change palette density and M switches palette mode when colorizing on GPU.
+// B saves current view as a bookmark, N and Shift+N jump to the next and the previous bookmark.
+// E exports current view as a location file of another explorer
+func (a *Application) KeyCallback(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if action != glfw.Press && action != glfw.Repeat {
+		return
+	}
+
+	// bookmarks regenerate the fractal, which takes the lock itself
+	switch {
+	case key == glfw.KeyB && action == glfw.Press:
+		a.saveBookmark()
+		return
+	case key == glfw.KeyN && mods&glfw.ModShift != 0:
+		a.cycleBookmark(-1)
+		return
+	case key == glfw.KeyN:
+		a.cycleBookmark(1)
+		return
+	case key == glfw.KeyE && action == glfw.Press:
+		a.exportLocation()
+		return
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	switch key {
+	case glfw.KeyC:
+		a.cycling.enabled = !a.cycling.enabled
+		a.cycling.lastTick = time.Now()
+		fmt.Printf("Palette cycling: %t\n", a.cycling.enabled)
+	case glfw.KeyR:
+		a.cycling.speed = -a.cycling.speed
+	case glfw.KeyEqual, glfw.KeyKPAdd:
+		if math.Abs(a.cycling.speed) < minCycleSpeed {
+			a.cycling.speed = math.Copysign(minCycleSpeed, a.cycling.speed)
+		} else {
+			a.cycling.speed *= cycleSpeedAdjustRatio
+		}
+		fmt.Printf("Palette cycling speed: %.3f\n", a.cycling.speed)
+	case glfw.KeyMinus, glfw.KeyKPSubtract:
+		a.cycling.speed /= cycleSpeedAdjustRatio
+		if math.Abs(a.cycling.speed) < minCycleSpeed {
+			a.cycling.speed = 0
+		}
+		fmt.Printf("Palette cycling speed: %.3f\n", a.cycling.speed)
+	case glfw.KeyG:
+		a.gpu.enabled = !a.gpu.enabled
+		a.refreshTexture = true
+		fmt.Printf("GPU colorizing: %t\n", a.gpu.enabled)
+		if a.gpu.enabled && !a.gpuSupported() {
+			fmt.Println("Shadings and layers are not supported on GPU, colorizing on CPU")
+		}
+	case glfw.KeyRightBracket:
+		a.gpu.density *= gpuDensityAdjustRatio
+		fmt.Printf("GPU palette density: %.3f\n", a.gpu.density)
+	case glfw.KeyLeftBracket:
+		a.gpu.density /= gpuDensityAdjustRatio
+		fmt.Printf("GPU palette density: %.3f\n", a.gpu.density)
+	case glfw.KeyM:
+		a.gpu.mode = (a.gpu.mode + 1) % (palette.ModeMirror + 1)
+		fmt.Printf("GPU palette mode: %d\n", a.gpu.mode)
+	}
+}
+
 func (a *Application) OnClick(x float64, y float64, button glfw.MouseButton) {
 	if a.generating {
 		return
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"mandelbrot/fieldcache"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultBatchMemory = 1024 // Memory budget of parallel jobs, megabytes
+
+	batchStatusDone    = "done"
+	batchStatusSkipped = "skipped"
+	batchStatusFailed  = "failed"
+)
+
+// batchFile is a job file. Every job starts from the defaults, so common options are given once
+type batchFile struct {
+	Defaults json.RawMessage   `json:"defaults"`
+	Jobs     []json.RawMessage `json:"jobs"`
+}
+
+// batchJob is a single image of the job file
+type batchJob struct {
+	renderOptions
+	Output  string `json:"output"`  // Output file, relative paths are relative to the job file
+	Format  string `json:"format"`  // png or jpeg, selected by the output extension if empty
+	Quality int    `json:"quality"` // JPEG quality
+}
+
+// batchResult is a line of the summary report
+type batchResult struct {
+	Output  string  `json:"output"`
+	Status  string  `json:"status"` // done, skipped or failed
+	Seconds float64 `json:"seconds"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Read job file, jobs are filled with the defaults first
+func loadBatchJobs(path string) ([]*batchJob, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read job file")
+	}
+
+	var file batchFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+
+	defaults := batchJob{
+		renderOptions: newRenderOptions(),
+		Quality:       DefaultJPEGQuality,
+	}
+	if len(file.Defaults) > 0 {
+		if err := json.Unmarshal(file.Defaults, &defaults); err != nil {
+			return nil, errors.Wrap(err, "defaults")
+		}
+	}
+
+	dir := filepath.Dir(path)
+	outputs := map[string]int{}
+
+	ret := make([]*batchJob, 0, len(file.Jobs))
+	for i, raw := range file.Jobs {
+		job := defaults
+		// decoding reuses slice memory, layers of the defaults must not be overwritten
+		job.Layers = append(layerFlags(nil), defaults.Layers...)
+		if err := json.Unmarshal(raw, &job); err != nil {
+			return nil, errors.Wrapf(err, "job %d", i+1)
+		}
+
+		if job.Output == "" {
+			return nil, fmt.Errorf("job %d: output is required", i+1)
+		}
+		if !filepath.IsAbs(job.Output) {
+			job.Output = filepath.Join(dir, job.Output)
+		}
+		if other, ok := outputs[job.Output]; ok {
+			return nil, fmt.Errorf("job %d: output %s is already used by job %d", i+1, job.Output, other)
+		}
+		outputs[job.Output] = i + 1
+
+		ret = append(ret, &job)
+	}
+
+	return ret, nil
+}
+
+// Estimate memory used while rendering the job
+func (j *batchJob) memory() int64 {
+	return int64(j.Width) * int64(j.Height) * j.pixelMemory()
+}
+
+// Check that output exists and is a complete image of the job size
+func (j *batchJob) done() bool {
+	return imageComplete(j.Output, j.Width, j.Height)
+}
+
+func (j *batchJob) run(cache *fieldcache.Cache) error {
+	if err := os.MkdirAll(filepath.Dir(j.Output), 0755); err != nil {
+		return errors.Wrap(err, "create output directory")
+	}
+
+	img, err := j.Render(cache, func(float32) {})
+	if err != nil {
+		return err
+	}
+
+	return writeImage(j.Output, img, j.Format, j.Quality)
+}
+
+// memoryBudget limits total memory of jobs running at once.
+// A job larger than the whole budget runs when no other job is running
+type memoryBudget struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	available int64
+	running   int
+}
+
+func newMemoryBudget(total int64) *memoryBudget {
+	ret := &memoryBudget{available: total}
+	ret.cond = sync.NewCond(&ret.mu)
+	return ret
+}
+
+func (b *memoryBudget) acquire(size int64) {
+	b.mu.Lock()
+	for b.running > 0 && size > b.available {
+		b.cond.Wait()
+	}
+	b.available -= size
+	b.running++
+	b.mu.Unlock()
+}
+
+func (b *memoryBudget) release(size int64) {
+	b.mu.Lock()
+	b.available += size
+	b.running--
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// Run jobs in parallel within the memory budget, results are in the order of jobs.
+// Generated fields are cached in the cache unless it is nil
+func runBatch(jobs []*batchJob, parallel int, memory int64, force bool, cache *fieldcache.Cache) []batchResult {
+	results := make([]batchResult, len(jobs))
+	budget := newMemoryBudget(memory)
+
+	var mu sync.Mutex
+	finished := 0
+	report := func(i int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		finished++
+		r := results[i]
+		switch r.Status {
+		case batchStatusFailed:
+			_, _ = fmt.Fprintf(os.Stderr, "[%d/%d] %s %s: %s\n", finished, len(jobs), r.Status, r.Output, r.Error)
+		case batchStatusSkipped:
+			_, _ = fmt.Fprintf(os.Stderr, "[%d/%d] %s %s\n", finished, len(jobs), r.Status, r.Output)
+		default:
+			_, _ = fmt.Fprintf(os.Stderr, "[%d/%d] %s %s in %.1fs\n", finished, len(jobs), r.Status, r.Output, r.Seconds)
+		}
+	}
+
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				job := jobs[i]
+				results[i].Output = job.Output
+
+				if !force && job.done() {
+					results[i].Status = batchStatusSkipped
+					report(i)
+					continue
+				}
+
+				size := job.memory()
+				budget.acquire(size)
+				started := time.Now()
+				err := job.run(cache)
+				budget.release(size)
+
+				results[i].Seconds = time.Since(started).Seconds()
+				results[i].Status = batchStatusDone
+				if err != nil {
+					results[i].Status = batchStatusFailed
+					results[i].Error = err.Error()
+				}
+				report(i)
+			}
+		}()
+	}
+
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	return results
+}
+
+// batch subcommand: render all the jobs of a JSON job file.
+// Rerunning the same file skips images that are already rendered
+func batchCommand(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	parallel := fs.Int("parallel", runtime.NumCPU()/2+1, "maximum number of jobs rendered at once")
+	memory := fs.Int("memory", DefaultBatchMemory, "memory budget of jobs rendered at once, megabytes")
+	force := fs.Bool("force", false, "render all jobs even if outputs exist")
+	reportPath := fs.String("report", "", "write JSON summary report to the file")
+	cacheOpts := newCacheOptions(0)
+	cacheOpts.register(fs)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: %s batch [options] <jobs.json>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 || *parallel < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	jobs, err := loadBatchJobs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	cache, err := cacheOpts.open()
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	results := runBatch(jobs, *parallel, int64(*memory)<<20, *force, cache)
+
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "%d jobs in %s: %d done, %d skipped, %d failed\n",
+		len(jobs), time.Since(started).Round(time.Millisecond),
+		counts[batchStatusDone], counts[batchStatusSkipped], counts[batchStatusFailed])
+
+	if *reportPath != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*reportPath, data, 0644); err != nil {
+			return errors.Wrap(err, "write report")
+		}
+	}
+
+	if counts[batchStatusFailed] > 0 {
+		return fmt.Errorf("%d of %d jobs failed", counts[batchStatusFailed], len(jobs))
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Bookmark is a named location. Coordinates are decimal strings, so they keep the full precision
+// and can be edited by hand. Empty physical sizes are derived from the scale and the screen aspect
+type Bookmark struct {
+	Name           string  `json:"name"`
+	CX             string  `json:"cx"`
+	CY             string  `json:"cy"`
+	Scale          string  `json:"scale"`
+	PhysicalWidth  string  `json:"physical_width,omitempty"`
+	PhysicalHeight string  `json:"physical_height,omitempty"`
+	Precision      uint    `json:"precision,omitempty"` // Floats precision of the values, bits
+	Rotation       float64 `json:"rotation,omitempty"`  // Counterclockwise view rotation, radians
+	Generator      string  `json:"generator,omitempty"`
+	Iterations     int     `json:"iterations,omitempty"`
+}
+
+// Famous locations available without a bookmarks file
+var builtinBookmarks = []Bookmark{
+	{Name: "home", CX: "-0.7", CY: "0", Scale: "1"},
+	{Name: "seahorse-valley", CX: "-0.7453", CY: "0.1127", Scale: "0.0033", Iterations: 1000},
+	{Name: "elephant-valley", CX: "0.2925", CY: "0.015", Scale: "0.015", Iterations: 1000},
+	{Name: "triple-spiral-valley", CX: "-0.0883", CY: "0.6549", Scale: "0.002", Iterations: 1000},
+	{Name: "scepter-valley", CX: "-1.36", CY: "0.0", Scale: "0.02", Iterations: 1000},
+	{Name: "period-3-minibrot", CX: "-1.7548776662466927", CY: "0", Scale: "0.02", Iterations: 1000},
+	{
+		Name:           "antenna-deep",
+		CX:             "-1.48656573768883788853042260418005804552266102547264",
+		CY:             "0.03579713550865033095370105522259793185378684565734",
+		Scale:          "0.00000000000000640180414098903887916742577864421037",
+		PhysicalWidth:  "0.00000000000001920541242296711114025336924125917013",
+		PhysicalHeight: "0.00000000000001280360828197809092253489087575796220",
+		Generator:      "big",
+		Iterations:     2000,
+	},
+}
+
+// Decimal text of the value widened to the precision, it is parsed back to the same value at that precision
+func decimalText(f *big.Float, precision uint) string {
+	return big.NewFloat(0).SetPrec(precision).Set(f).Text('g', -1)
+}
+
+// NewBookmark saves the state view with the generator settings
+func NewBookmark(name string, state *State, generator string, iterations int) Bookmark {
+	return Bookmark{
+		Name:           name,
+		CX:             decimalText(state.GetCX(), state.GetPrecision()),
+		CY:             decimalText(state.GetCY(), state.GetPrecision()),
+		Scale:          decimalText(state.GetScale(), state.GetPrecision()),
+		PhysicalWidth:  decimalText(state.GetPhysicalWidth(), state.GetPrecision()),
+		PhysicalHeight: decimalText(state.GetPhysicalHeight(), state.GetPrecision()),
+		Precision:      state.GetPrecision(),
+		Rotation:       state.GetRotation(),
+		Generator:      generator,
+		Iterations:     iterations,
+	}
+}
+
+// Apply moves the state to the bookmarked view, screen size of the state is kept.
+// All the values are parsed first, so the state is unchanged on error
+func (b Bookmark) Apply(state *State) error {
+	precision := state.GetPrecision()
+	if b.Precision > precision {
+		precision = b.Precision
+	}
+
+	parse := func(name, s string) (*big.Float, error) {
+		f, _, err := big.ParseFloat(s, 10, precision, big.ToNearestEven)
+		if err != nil {
+			return nil, fmt.Errorf("bookmark %s: invalid %s %q: %v", b.Name, name, s, err)
+		}
+		return f, nil
+	}
+
+	cx, err := parse("cx", b.CX)
+	if err != nil {
+		return err
+	}
+	cy, err := parse("cy", b.CY)
+	if err != nil {
+		return err
+	}
+	scale, err := parse("scale", b.Scale)
+	if err != nil {
+		return err
+	}
+	if scale.Sign() <= 0 {
+		return fmt.Errorf("bookmark %s: scale must be positive", b.Name)
+	}
+
+	var physWidth, physHeight *big.Float
+	if b.PhysicalWidth != "" && b.PhysicalHeight != "" {
+		if physWidth, err = parse("physical_width", b.PhysicalWidth); err != nil {
+			return err
+		}
+		if physHeight, err = parse("physical_height", b.PhysicalHeight); err != nil {
+			return err
+		}
+	} else {
+		// current aspect of the view is kept, so "home" is the view shown at startup
+		aspect := big.NewFloat(0).SetPrec(precision).Quo(state.GetPhysicalWidth(), state.GetPhysicalHeight())
+		physHeight = big.NewFloat(DefaultPhysicalHeight).SetPrec(precision)
+		physHeight.Mul(physHeight, scale)
+		physWidth = big.NewFloat(0).SetPrec(precision).Mul(physHeight, aspect)
+	}
+
+	state.SetPrecision(precision)
+	state.GetCX().Set(cx)
+	state.GetCY().Set(cy)
+	state.GetScale().Set(scale)
+	state.GetPhysicalWidth().SetPrec(precision).Set(physWidth)
+	state.GetPhysicalHeight().SetPrec(precision).Set(physHeight)
+	state.SetRotation(b.Rotation)
+
+	return nil
+}
+
+// BookmarkStore keeps bookmarks saved by the user in a JSON file
+type BookmarkStore struct {
+	path  string
+	saved []Bookmark
+}
+
+// Default bookmarks file in the user config directory
+func DefaultBookmarksPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "mandelbrot", "bookmarks.json"), nil
+}
+
+// NewBookmarkStore loads bookmarks from the file, missing file has no bookmarks
+func NewBookmarkStore(path string) (*BookmarkStore, error) {
+	ret := &BookmarkStore{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ret, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read bookmarks")
+	}
+
+	if err := json.Unmarshal(data, &ret.saved); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+
+	return ret, nil
+}
+
+// GetBookmarks returns built-in bookmarks followed by the saved ones
+func (s *BookmarkStore) GetBookmarks() []Bookmark {
+	ret := make([]Bookmark, 0, len(builtinBookmarks)+len(s.saved))
+	ret = append(ret, builtinBookmarks...)
+
+	return append(ret, s.saved...)
+}
+
+// Find bookmark by name, saved bookmarks take precedence over built-in ones
+func (s *BookmarkStore) Find(name string) (Bookmark, bool) {
+	bookmarks := s.GetBookmarks()
+	for i := len(bookmarks) - 1; i >= 0; i-- {
+		if bookmarks[i].Name == name {
+			return bookmarks[i], true
+		}
+	}
+
+	return Bookmark{}, false
+}
+
+// Save adds the bookmark replacing a saved one of the same name, and writes the file
+func (s *BookmarkStore) Save(b Bookmark) error {
+	replaced := false
+	for i := range s.saved {
+		if s.saved[i].Name == b.Name {
+			s.saved[i] = b
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.saved = append(s.saved, b)
+	}
+
+	data, err := json.MarshalIndent(s.saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(writeFileAtomic(s.path, append(data, '\n')), "save bookmarks")
+}
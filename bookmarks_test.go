@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestBookmarkRoundTrip(t *testing.T) {
+	state, err := NewStateView(
+		"-1.486565737688837888530422604180058045522661025472640123456789",
+		"0.035797135508650330953701055222597931853786845657340987654321",
+		"1.5620596e44", 800, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetRotation(0.25)
+
+	b := NewBookmark("deep", state, "big", 5000)
+	restored := NewState()
+	if err := b.Apply(restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.GetPrecision() != state.GetPrecision() {
+		t.Errorf("precision %d, expected %d", restored.GetPrecision(), state.GetPrecision())
+	}
+	for _, v := range []struct {
+		name      string
+		got, want *big.Float
+	}{
+		{"cx", restored.GetCX(), state.GetCX()},
+		{"cy", restored.GetCY(), state.GetCY()},
+		{"scale", restored.GetScale(), state.GetScale()},
+		{"physical width", restored.GetPhysicalWidth(), state.GetPhysicalWidth()},
+		{"physical height", restored.GetPhysicalHeight(), state.GetPhysicalHeight()},
+	} {
+		if v.got.Cmp(v.want) != 0 {
+			t.Errorf("%s is %s, expected %s", v.name, v.got.Text('g', -1), v.want.Text('g', -1))
+		}
+	}
+	if restored.GetRotation() != state.GetRotation() {
+		t.Errorf("rotation is %g, expected %g", restored.GetRotation(), state.GetRotation())
+	}
+}
+
+func TestBookmarkKeepsAspect(t *testing.T) {
+	// the view at startup is 3x2 on the 640x480 screen, the home bookmark shows the same view
+	state := NewState()
+	if err := builtinBookmarks[0].Apply(state); err != nil {
+		t.Fatal(err)
+	}
+
+	width, _ := state.GetPhysicalWidth().Float64()
+	height, _ := state.GetPhysicalHeight().Float64()
+	if math.Abs(width-DefaultPhysicalWidth) > 1e-12 || math.Abs(height-DefaultPhysicalHeight) > 1e-12 {
+		t.Errorf("physical size is %gx%g, expected %gx%g", width, height, DefaultPhysicalWidth, DefaultPhysicalHeight)
+	}
+}
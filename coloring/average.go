@@ -0,0 +1,70 @@
+package coloring
+
+import (
+	"mandelbrot/fractal"
+)
+
+const (
+	// Escape radius for averaging colorings.
+	// Small radius makes interpolation between iterations visible as bands
+	DefaultAverageBailout = 1000.0
+
+	// Default frequency of stripe average
+	DefaultStripeDensity = 5.0
+
+	// Default number of palette repeats of triangle inequality average
+	DefaultTIADensity = 1.0
+)
+
+// StripeAverage colors escaped points by the average of sin(density * arg(z)) over the orbit
+type StripeAverage struct {
+	density float64
+}
+
+func NewStripeAverage(density float64) *StripeAverage {
+	return &StripeAverage{
+		density: density,
+	}
+}
+
+func (c *StripeAverage) Options() fractal.OrbitOptions {
+	return fractal.OrbitOptions{
+		Bailout:       DefaultAverageBailout,
+		StripeDensity: c.density,
+	}
+}
+
+func (c *StripeAverage) Value(orbit *fractal.Orbit) float32 {
+	if !orbit.Escaped {
+		return 0
+	}
+
+	return clamp(orbit.Stripe.Smooth(orbit.SmoothFraction()))
+}
+
+// TriangleInequality colors escaped points by triangle inequality average (TIA) over the orbit.
+// density scales the averaged value, so the palette repeats density times
+type TriangleInequality struct {
+	density float64
+}
+
+func NewTriangleInequality(density float64) *TriangleInequality {
+	return &TriangleInequality{
+		density: density,
+	}
+}
+
+func (c *TriangleInequality) Options() fractal.OrbitOptions {
+	return fractal.OrbitOptions{
+		Bailout: DefaultAverageBailout,
+		TIA:     true,
+	}
+}
+
+func (c *TriangleInequality) Value(orbit *fractal.Orbit) float32 {
+	if !orbit.Escaped {
+		return 0
+	}
+
+	return repeat(orbit.TIA.Smooth(orbit.SmoothFraction()) * c.density)
+}
@@ -0,0 +1,82 @@
+package coloring
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// BlendMode defines how a layer color is combined with the color below it
+type BlendMode int
+
+const (
+	BlendNormal BlendMode = iota
+	BlendMultiply
+	BlendScreen
+	BlendOverlay
+	BlendSoftLight
+)
+
+// ParseBlendMode parses blend mode name: normal, multiply, screen, overlay or softlight
+func ParseBlendMode(s string) (BlendMode, error) {
+	switch s {
+	case "normal":
+		return BlendNormal, nil
+	case "multiply":
+		return BlendMultiply, nil
+	case "screen":
+		return BlendScreen, nil
+	case "overlay":
+		return BlendOverlay, nil
+	case "softlight":
+		return BlendSoftLight, nil
+	default:
+		return 0, fmt.Errorf("unknown blend mode: %s", s)
+	}
+}
+
+// Blend combines layer color with the backdrop color.
+// opacity in range [0, 1] is multiplied by the layer alpha
+func (m BlendMode) Blend(backdrop, layer color.RGBA, opacity float64) color.RGBA {
+	alpha := opacity * float64(layer.A) / 255
+
+	blend := func(a, b uint8) uint8 {
+		x, y := float64(a)/255, float64(b)/255
+		return uint8((x+(m.blendComponent(x, y)-x)*alpha)*255 + 0.5)
+	}
+
+	return color.RGBA{
+		R: blend(backdrop.R, layer.R),
+		G: blend(backdrop.G, layer.G),
+		B: blend(backdrop.B, layer.B),
+		A: backdrop.A,
+	}
+}
+
+// Blend color components in range [0, 1]: a is the backdrop, b is the layer
+func (m BlendMode) blendComponent(a, b float64) float64 {
+	switch m {
+	case BlendMultiply:
+		return a * b
+	case BlendScreen:
+		return 1 - (1-a)*(1-b)
+	case BlendOverlay:
+		if a < 0.5 {
+			return 2 * a * b
+		}
+		return 1 - 2*(1-a)*(1-b)
+	case BlendSoftLight:
+		if b <= 0.5 {
+			return a - (1-2*b)*a*(1-a)
+		}
+		var d float64
+		if a <= 0.25 {
+			d = ((16*a-12)*a + 4) * a
+		} else {
+			d = math.Sqrt(a)
+		}
+		return a + (2*b-1)*(d-a)
+	default:
+		return b
+	}
+}
@@ -0,0 +1,35 @@
+package coloring
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestBlendModes(t *testing.T) {
+	gray := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	black := color.RGBA{A: 255}
+
+	tests := []struct {
+		mode     BlendMode
+		backdrop color.RGBA
+		layer    color.RGBA
+		opacity  float64
+		expected color.RGBA
+	}{
+		{BlendNormal, black, white, 1, white},
+		{BlendNormal, black, white, 0, black},
+		{BlendMultiply, gray, white, 1, gray},
+		{BlendMultiply, gray, black, 1, black},
+		{BlendScreen, gray, black, 1, gray},
+		{BlendScreen, gray, white, 1, white},
+		{BlendOverlay, white, gray, 1, white},
+		{BlendSoftLight, black, white, 1, black},
+	}
+
+	for i, test := range tests {
+		if got := test.mode.Blend(test.backdrop, test.layer, test.opacity); got != test.expected {
+			t.Errorf("test %d: got %+v, expected %+v", i, got, test.expected)
+		}
+	}
+}
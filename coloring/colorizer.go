@@ -0,0 +1,278 @@
+package coloring
+
+import (
+	"image"
+	"image/color"
+	"mandelbrot/fractal"
+)
+
+// Palette position of points which didn't escape
+const InsidePosition = -1
+
+// Colorizer converts collected orbits of the frame into image colors.
+// Coloring gives a value for every point, mapping spreads values over the palette
+// and shadings are applied to the resulting palette colors.
+// Colors of additional layers are blended on top of the result
+type Colorizer struct {
+	coloring fractal.Coloring
+	shadings []fractal.Shading
+	mapping  Mapping
+	palette  color.Palette
+	offset   float64 // Palette offset of escaped points, used for palette cycling
+	layers   []layer
+	mapFunc  MapFunc // Mapping built by Calibrate, nil to build mapping for every field
+}
+
+// layer is a colorizer which colors are blended on top of the colors below it
+type layer struct {
+	colorizer *Colorizer
+	opacity   float64
+	blend     BlendMode
+}
+
+func NewColorizer(coloring fractal.Coloring, palette color.Palette) *Colorizer {
+	return &Colorizer{
+		coloring: coloring,
+		mapping:  NewLinearMapping(TransferLinear),
+		palette:  palette,
+	}
+}
+
+// SetShadings sets shadings applied to the palette colors
+func (c *Colorizer) SetShadings(shadings ...fractal.Shading) {
+	c.shadings = shadings
+}
+
+// SetMapping sets the way coloring values are spread over the palette
+func (c *Colorizer) SetMapping(mapping Mapping) {
+	c.mapping = mapping
+}
+
+// AddLayer adds a layer blended on top of colors of the colorizer and all the previously added layers.
+// Layers are applied to escaped points only, opacity is in range [0, 1]
+func (c *Colorizer) AddLayer(colorizer *Colorizer, opacity float64, blend BlendMode) {
+	c.layers = append(c.layers, layer{
+		colorizer: colorizer,
+		opacity:   opacity,
+		blend:     blend,
+	})
+}
+
+// GetLayersCount returns number of additional layers
+func (c *Colorizer) GetLayersCount() int {
+	return len(c.layers)
+}
+
+// SetOffset shifts palette positions of escaped points of the colorizer and all its layers.
+// The palette wraps around
+func (c *Colorizer) SetOffset(offset float64) {
+	c.offset = offset
+	for _, l := range c.layers {
+		l.colorizer.SetOffset(offset)
+	}
+}
+
+// Calibrate builds mapping of the colorizer and all its layers from the field and keeps it for
+// the following fields, so parts of a large image colored one by one get matching colors.
+// Usually the field is a small preview of the whole image. Nil field drops the kept mapping
+func (c *Colorizer) Calibrate(field *fractal.Field) {
+	c.mapFunc = nil
+	if field != nil {
+		c.mapFunc = c.mapping.Build(c.escapedValues(field, make([]float32, len(field.Orbits)), nil))
+	}
+
+	for _, l := range c.layers {
+		l.colorizer.Calibrate(field)
+	}
+}
+
+// NeedsCalibration reports whether colors depend on values of the whole field, like with histogram mapping.
+// Parts of a large image get matching colors only when such a colorizer is calibrated
+func (c *Colorizer) NeedsCalibration() bool {
+	if _, ok := c.mapping.(*LinearMapping); !ok {
+		return true
+	}
+	for _, l := range c.layers {
+		if l.colorizer.NeedsCalibration() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Options returns orbit values required by the coloring and all the shadings
+func (c *Colorizer) Options() fractal.OrbitOptions {
+	ret := c.coloring.Options()
+	for _, shading := range c.shadings {
+		ret = ret.Merge(shading.Options())
+	}
+	for _, l := range c.layers {
+		ret = ret.Merge(l.colorizer.Options())
+	}
+
+	return ret
+}
+
+// GetPalette returns palette colors
+func (c *Colorizer) GetPalette() color.Palette {
+	return c.palette
+}
+
+// GetShadings returns shadings applied to the palette colors
+func (c *Colorizer) GetShadings() []fractal.Shading {
+	return c.shadings
+}
+
+// Positions calculates palette positions of all the field points into target.
+// Target must be of the field size. Points which didn't escape get negative position
+func (c *Colorizer) Positions(field *fractal.Field, target []float32) {
+	c.positions(field, target, nil)
+}
+
+// Calculate palette positions reusing memory of escaped for values of escaped points
+func (c *Colorizer) positions(field *fractal.Field, target []float32, escaped []float32) []float32 {
+	// collect values of the whole frame first, mapping may depend on all of them
+	escaped = c.escapedValues(field, target, escaped)
+
+	mapFunc := c.mapFunc
+	if mapFunc == nil {
+		mapFunc = c.mapping.Build(escaped)
+	}
+
+	for i := range field.Orbits {
+		if field.Orbits[i].Escaped {
+			target[i] = mapFunc(target[i])
+		} else {
+			target[i] = InsidePosition
+		}
+	}
+
+	return escaped
+}
+
+// Calculate coloring values of all the field points into target, values of escaped points are returned.
+// Memory of escaped is reused if it's large enough
+func (c *Colorizer) escapedValues(field *fractal.Field, target []float32, escaped []float32) []float32 {
+	ret := escaped[:0]
+	if cap(ret) < len(field.Orbits) {
+		ret = make([]float32, 0, len(field.Orbits))
+	}
+	for i := range field.Orbits {
+		target[i] = c.coloring.Value(&field.Orbits[i])
+		if field.Orbits[i].Escaped {
+			ret = append(ret, target[i])
+		}
+	}
+
+	return ret
+}
+
+// Buffer keeps memory used by colorizing between calls, so coloring a field again,
+// like on every frame of palette cycling, doesn't allocate. A buffer must not be used by concurrent calls
+type Buffer struct {
+	positions []float32
+	escaped   []float32
+	layerImg  *image.RGBA
+	layers    []Buffer
+}
+
+// Colorize draws the field into target image. Image must be of the field size
+func (c *Colorizer) Colorize(field *fractal.Field, target *image.RGBA) {
+	c.ColorizeBuffer(field, target, &Buffer{})
+}
+
+// ColorizeBuffer works as Colorize, memory used while colorizing is kept in the buffer
+func (c *Colorizer) ColorizeBuffer(field *fractal.Field, target *image.RGBA, buf *Buffer) {
+	pal := paletteRGBA(c.palette)
+
+	if cap(buf.positions) < len(field.Orbits) {
+		buf.positions = make([]float32, len(field.Orbits))
+	}
+	positions := buf.positions[:len(field.Orbits)]
+	buf.escaped = c.positions(field, positions, buf.escaped)
+
+	for y := 0; y < field.Height; y++ {
+		for x := 0; x < field.Width; x++ {
+			i := y*field.Width + x
+			orbit := &field.Orbits[i]
+
+			position := positions[i]
+			if position == InsidePosition {
+				position = 0
+			} else if c.offset != 0 {
+				position = repeat(float64(position) + c.offset)
+			}
+
+			pixel := paletteColor(pal, position)
+			for _, shading := range c.shadings {
+				pixel = shading.Shade(pixel, orbit)
+			}
+
+			target.SetRGBA(x, y, pixel)
+		}
+	}
+
+	if len(c.layers) == 0 {
+		return
+	}
+
+	if len(buf.layers) != len(c.layers) {
+		buf.layers = make([]Buffer, len(c.layers))
+	}
+
+	if buf.layerImg == nil || buf.layerImg.Rect != target.Rect {
+		buf.layerImg = image.NewRGBA(target.Rect)
+	}
+	layerImg := buf.layerImg
+
+	for i, l := range c.layers {
+		l.colorizer.ColorizeBuffer(field, layerImg, &buf.layers[i])
+
+		// points inside the set keep colors of the base layer
+		for y := 0; y < field.Height; y++ {
+			for x := 0; x < field.Width; x++ {
+				if field.At(x, y).Escaped {
+					target.SetRGBA(x, y, l.blend.Blend(target.RGBAAt(x, y), layerImg.RGBAAt(x, y), l.opacity))
+				}
+			}
+		}
+	}
+}
+
+// PaletteRGBA returns palette colors as 8-bit RGBA components, 4 bytes per color
+func (c *Colorizer) PaletteRGBA() []uint8 {
+	return PaletteRGBA(c.palette)
+}
+
+// PaletteRGBA returns colors of the palette as 8-bit RGBA components, 4 bytes per color
+func PaletteRGBA(pal color.Palette) []uint8 {
+	ret := make([]uint8, 0, len(pal)*4)
+	for _, pixel := range paletteRGBA(pal) {
+		ret = append(ret, pixel.R, pixel.G, pixel.B, pixel.A)
+	}
+
+	return ret
+}
+
+// Convert palette colors to RGBA once, instead of doing it for every pixel
+func paletteRGBA(pal color.Palette) []color.RGBA {
+	ret := make([]color.RGBA, len(pal))
+	for i := range pal {
+		ret[i] = color.RGBAModel.Convert(pal[i]).(color.RGBA)
+	}
+
+	return ret
+}
+
+// Convert palette position in range [0, 1] into the palette color
+func paletteColor(pal []color.RGBA, value float32) color.RGBA {
+	index := int(float32(len(pal)) * value)
+	if index >= len(pal) {
+		index = len(pal) - 1
+	} else if index < 0 {
+		index = 0
+	}
+
+	return pal[index]
+}
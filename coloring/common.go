@@ -0,0 +1,30 @@
+package coloring
+
+import (
+	"image/color"
+	"math"
+)
+
+// clamp limits value to range [0, 1]
+func clamp(value float64) float32 {
+	return float32(math.Max(0, math.Min(1, value)))
+}
+
+// repeat wraps value to range [0, 1)
+func repeat(value float64) float32 {
+	return float32(value - math.Floor(value))
+}
+
+// mix linearly interpolates between colors a and b, t is in range [0, 1]
+func mix(a, b color.RGBA, t float64) color.RGBA {
+	lerp := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*t + 0.5)
+	}
+
+	return color.RGBA{
+		R: lerp(a.R, b.R),
+		G: lerp(a.G, b.G),
+		B: lerp(a.B, b.B),
+		A: lerp(a.A, b.A),
+	}
+}
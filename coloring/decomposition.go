@@ -0,0 +1,103 @@
+package coloring
+
+import (
+	"image/color"
+	"mandelbrot/fractal"
+	"math"
+	"math/cmplx"
+)
+
+// BinaryDecomposition colors escaped points by the sign of Im(z) at escape.
+// Points with positive imaginary part take the last palette color, others take the middle one,
+// so they differ from points inside the set which take the first one
+type BinaryDecomposition struct{}
+
+func NewBinaryDecomposition() *BinaryDecomposition {
+	return &BinaryDecomposition{}
+}
+
+func (c *BinaryDecomposition) Options() fractal.OrbitOptions {
+	return fractal.OrbitOptions{
+		Bailout: DefaultAverageBailout,
+	}
+}
+
+func (c *BinaryDecomposition) Value(orbit *fractal.Orbit) float32 {
+	if !orbit.Escaped {
+		return 0
+	}
+
+	if imag(orbit.Z) < 0 {
+		return 0.5
+	}
+
+	return 1
+}
+
+// ExternalAngle colors escaped points by the argument of z at escape mapped to range [0, 1)
+type ExternalAngle struct{}
+
+func NewExternalAngle() *ExternalAngle {
+	return &ExternalAngle{}
+}
+
+func (c *ExternalAngle) Options() fractal.OrbitOptions {
+	return fractal.OrbitOptions{
+		Bailout: DefaultAverageBailout,
+	}
+}
+
+func (c *ExternalAngle) Value(orbit *fractal.Orbit) float32 {
+	if !orbit.Escaped {
+		return 0
+	}
+
+	return repeat(externalAngle(orbit.Z))
+}
+
+// Default width of field lines relative to the distance between lines
+const DefaultFieldLinesWidth = 0.1
+
+// FieldLines draws field lines of the set on top of the palette colors.
+// Lines are placed where the external angle at escape is a multiple of 1/count.
+// The generator's bailout is kept, so escape counts of the base coloring don't change with the overlay
+type FieldLines struct {
+	count     int
+	width     float64 // Line width relative to the distance between lines
+	lineColor color.RGBA
+}
+
+func NewFieldLines(count int, width float64, lineColor color.RGBA) *FieldLines {
+	return &FieldLines{
+		count:     count,
+		width:     width,
+		lineColor: lineColor,
+	}
+}
+
+func (s *FieldLines) Options() fractal.OrbitOptions {
+	return fractal.OrbitOptions{}
+}
+
+func (s *FieldLines) Shade(c color.RGBA, orbit *fractal.Orbit) color.RGBA {
+	if !orbit.Escaped || s.width <= 0 {
+		return c
+	}
+
+	// distance to the nearest line, in units of distance between lines
+	angle := externalAngle(orbit.Z) * float64(s.count)
+	distance := math.Abs(angle - math.Round(angle))
+
+	halfWidth := s.width / 2
+	if distance >= halfWidth {
+		return c
+	}
+
+	// fade line edges out to avoid aliasing
+	return mix(c, s.lineColor, 1-distance/halfWidth)
+}
+
+// externalAngle returns the argument of z in turns: range [-0.5, 0.5]
+func externalAngle(z complex128) float64 {
+	return cmplx.Phase(z) / (2 * math.Pi)
+}
@@ -0,0 +1,43 @@
+package coloring
+
+import (
+	"image"
+	"image/color"
+	"mandelbrot/fractal"
+	"testing"
+)
+
+func TestBinaryDecompositionInterior(t *testing.T) {
+	field := &fractal.Field{
+		Width:  3,
+		Height: 1,
+		Orbits: []fractal.Orbit{
+			{Escaped: false, Z: complex(0, -1)},
+			{Escaped: true, Z: complex(3, -1)},
+			{Escaped: true, Z: complex(3, 1)},
+		},
+	}
+
+	colorizer := NewColorizer(NewBinaryDecomposition(), color.Palette{
+		color.RGBA{A: 255},
+		color.RGBA{R: 128, A: 255},
+		color.RGBA{G: 255, A: 255},
+	})
+
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	colorizer.Colorize(field, img)
+
+	inside, below, above := img.RGBAAt(0, 0), img.RGBAAt(1, 0), img.RGBAAt(2, 0)
+	if inside == below || inside == above || below == above {
+		t.Errorf("inside %v, below %v and above %v must differ", inside, below, above)
+	}
+}
+
+func TestFieldLinesKeepBailout(t *testing.T) {
+	colorizer := NewColorizer(NewEscapeTime(), color.Palette{color.Black})
+	colorizer.SetShadings(NewFieldLines(8, DefaultFieldLinesWidth, color.RGBA{A: 255}))
+
+	if bailout := colorizer.Options().Bailout; bailout != 0 {
+		t.Errorf("field lines changed the bailout to %g", bailout)
+	}
+}
@@ -0,0 +1,73 @@
+package coloring
+
+import (
+	"mandelbrot/fractal"
+)
+
+// EscapeTime colors points by the number of iterations done before escape
+type EscapeTime struct{}
+
+func NewEscapeTime() *EscapeTime {
+	return &EscapeTime{}
+}
+
+func (c *EscapeTime) Options() fractal.OrbitOptions {
+	return fractal.OrbitOptions{}
+}
+
+func (c *EscapeTime) Value(orbit *fractal.Orbit) float32 {
+	if !orbit.Escaped {
+		return 0
+	}
+
+	return float32(orbit.Iterations-1) / float32(orbit.MaxIterations)
+}
+
+// SmoothEscapeTime colors points by the continuous iteration count, the normalized iteration count.
+// Escape time bands are blended by how far the last orbit value got over the bailout
+type SmoothEscapeTime struct{}
+
+func NewSmoothEscapeTime() *SmoothEscapeTime {
+	return &SmoothEscapeTime{}
+}
+
+func (c *SmoothEscapeTime) Options() fractal.OrbitOptions {
+	return fractal.OrbitOptions{
+		Bailout: DefaultAverageBailout,
+	}
+}
+
+func (c *SmoothEscapeTime) Value(orbit *fractal.Orbit) float32 {
+	if !orbit.Escaped {
+		return 0
+	}
+
+	// continuous count lies between the last two iterations, it's the escape time at the bailout
+	count := float64(orbit.Iterations-2) + orbit.SmoothFraction()
+
+	return clamp(count / float64(orbit.MaxIterations))
+}
+
+// Flat gives the same value to all escaped points.
+// Useful for layers that only carry shadings, like lighting
+type Flat struct {
+	value float32
+}
+
+func NewFlat(value float32) *Flat {
+	return &Flat{
+		value: value,
+	}
+}
+
+func (c *Flat) Options() fractal.OrbitOptions {
+	return fractal.OrbitOptions{}
+}
+
+func (c *Flat) Value(orbit *fractal.Orbit) float32 {
+	if !orbit.Escaped {
+		return 0
+	}
+
+	return c.value
+}
@@ -0,0 +1,32 @@
+package coloring
+
+import (
+	"mandelbrot/fractal"
+	"math"
+	"testing"
+)
+
+func TestSmoothEscapeTime(t *testing.T) {
+	smooth, escape := NewSmoothEscapeTime(), NewEscapeTime()
+	bailout := smooth.Options().Bailout
+
+	orbit := fractal.Orbit{Iterations: 10, MaxIterations: 100, Bailout: bailout, Escaped: true}
+
+	// orbit escaped right at the bailout gets the escape time
+	orbit.Z = complex(bailout, 0)
+	if got, expected := smooth.Value(&orbit), escape.Value(&orbit); math.Abs(float64(got-expected)) > 1e-6 {
+		t.Errorf("value at the bailout is %f, expected %f", got, expected)
+	}
+
+	// squared bailout is reached a whole iteration earlier
+	orbit.Z = complex(bailout*bailout, 0)
+	if got, expected := smooth.Value(&orbit), float32(8)/100; math.Abs(float64(got-expected)) > 1e-6 {
+		t.Errorf("value at the squared bailout is %f, expected %f", got, expected)
+	}
+
+	// and values between them are continuous
+	orbit.Z = complex(math.Pow(bailout, 1.5), 0)
+	if got := smooth.Value(&orbit); got <= 0.08 || got >= 0.09 {
+		t.Errorf("value between the iterations is %f", got)
+	}
+}
@@ -0,0 +1,96 @@
+package coloring
+
+import (
+	"image/color"
+	"mandelbrot/fractal"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	DefaultLightAngle    = 45.0 // Light direction in the image plane, degrees
+	DefaultLightHeight   = 1.5  // Light elevation over the image plane
+	DefaultLightStrength = 0.75 // How much of the lit color is blended into the palette color
+
+	lightAmbient   = 0.2
+	lightDiffuse   = 0.8
+	lightSpecular  = 0.4
+	lightShininess = 20.0
+)
+
+// Lighting shades escaped points as a lit 3D surface.
+// Surface normal is built from the distance estimate derivative: u = z / dz.
+// Diffuse part is Lambertian, specular part is Blinn-Phong
+type Lighting struct {
+	light    [3]float64 // Normalized light direction
+	halfway  [3]float64 // Normalized Blinn-Phong halfway vector
+	strength float64
+}
+
+// angle is the light direction in degrees, height is the light elevation over the image plane
+func NewLighting(angle, height, strength float64) *Lighting {
+	angleRad := angle * math.Pi / 180
+
+	light := normalize([3]float64{math.Cos(angleRad), math.Sin(angleRad), height})
+
+	// the viewer looks straight at the image plane
+	halfway := normalize([3]float64{light[0], light[1], light[2] + 1})
+
+	return &Lighting{
+		light:    light,
+		halfway:  halfway,
+		strength: strength,
+	}
+}
+
+func (s *Lighting) Options() fractal.OrbitOptions {
+	return fractal.OrbitOptions{
+		Derivative: true,
+	}
+}
+
+func (s *Lighting) Shade(c color.RGBA, orbit *fractal.Orbit) color.RGBA {
+	if !orbit.Escaped || orbit.DZ == 0 {
+		return c
+	}
+
+	u := orbit.Z / orbit.DZ
+	if cmplx.Abs(u) == 0 {
+		return c
+	}
+	u /= complex(cmplx.Abs(u), 0)
+
+	normal := normalize([3]float64{real(u), imag(u), 1})
+
+	diffuse := math.Max(0, dot(normal, s.light))
+	specular := math.Pow(math.Max(0, dot(normal, s.halfway)), lightShininess)
+
+	brightness := lightAmbient + lightDiffuse*diffuse
+	highlight := lightSpecular * specular * 255
+
+	shade := func(v uint8) uint8 {
+		return uint8(math.Min(255, float64(v)*brightness+highlight))
+	}
+
+	lit := color.RGBA{
+		R: shade(c.R),
+		G: shade(c.G),
+		B: shade(c.B),
+		A: c.A,
+	}
+
+	return mix(c, lit, s.strength)
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func normalize(v [3]float64) [3]float64 {
+	length := math.Sqrt(dot(v, v))
+	if length == 0 {
+		return v
+	}
+
+	return [3]float64{v[0] / length, v[1] / length, v[2] / length}
+}
@@ -0,0 +1,176 @@
+package coloring
+
+import (
+	"math"
+)
+
+// MapFunc converts coloring value into the palette position in range [0, 1]
+type MapFunc func(value float32) float32
+
+// Mapping defines how coloring values are spread over the palette
+type Mapping interface {
+	// Build returns a function converting values into palette positions.
+	// values are coloring values of all the escaped points of the frame
+	Build(values []float32) MapFunc
+}
+
+// Transfer is a function applied to the palette position after mapping
+type Transfer int
+
+const (
+	TransferLinear Transfer = iota
+	TransferSqrt
+	TransferLog
+)
+
+// Scale of logarithmic transfer: log(1 + scale*x) / log(1 + scale)
+const transferLogScale = 1000.0
+
+// Number of histogram bins used by histogram and rank mappings.
+// Bins cover the range of the frame values, so clustered values still fall into distinct bins
+const histogramBins = 4096
+
+func (t Transfer) apply(value float32) float32 {
+	switch t {
+	case TransferSqrt:
+		return float32(math.Sqrt(float64(value)))
+	case TransferLog:
+		return float32(math.Log1p(transferLogScale*float64(value)) / math.Log1p(transferLogScale))
+	default:
+		return value
+	}
+}
+
+// LinearMapping maps coloring values to palette positions as is
+type LinearMapping struct {
+	transfer Transfer
+}
+
+func NewLinearMapping(transfer Transfer) *LinearMapping {
+	return &LinearMapping{
+		transfer: transfer,
+	}
+}
+
+func (m *LinearMapping) Build(values []float32) MapFunc {
+	return func(value float32) float32 {
+		return m.transfer.apply(value)
+	}
+}
+
+// HistogramMapping maps coloring values by their cumulative frequency over the frame,
+// so every palette color covers about the same area of the image
+type HistogramMapping struct {
+	transfer Transfer
+}
+
+func NewHistogramMapping(transfer Transfer) *HistogramMapping {
+	return &HistogramMapping{
+		transfer: transfer,
+	}
+}
+
+func (m *HistogramMapping) Build(values []float32) MapFunc {
+	bins := newHistogramRange(values)
+	counts := bins.count(values)
+
+	// position of a bin is the share of values below it plus half of the bin itself
+	positions := make([]float32, histogramBins)
+	total := float32(len(values))
+	var below float32
+	for i, count := range counts {
+		if total > 0 {
+			positions[i] = (below + float32(count)/2) / total
+		}
+		below += float32(count)
+	}
+
+	return func(value float32) float32 {
+		return m.transfer.apply(positions[bins.bin(value)])
+	}
+}
+
+// RankMapping maps coloring values by the rank of their value among all the values of the frame.
+// Unlike HistogramMapping every distinct value gets the same share of the palette
+type RankMapping struct {
+	transfer Transfer
+}
+
+func NewRankMapping(transfer Transfer) *RankMapping {
+	return &RankMapping{
+		transfer: transfer,
+	}
+}
+
+func (m *RankMapping) Build(values []float32) MapFunc {
+	bins := newHistogramRange(values)
+	counts := bins.count(values)
+
+	ranks := make([]int, histogramBins)
+	distinct := 0
+	for i, count := range counts {
+		ranks[i] = distinct
+		if count > 0 {
+			distinct++
+		}
+	}
+
+	return func(value float32) float32 {
+		if distinct < 2 {
+			return m.transfer.apply(value)
+		}
+		return m.transfer.apply(float32(ranks[bins.bin(value)]) / float32(distinct-1))
+	}
+}
+
+// histogramRange splits the range between the smallest and the largest value into equal bins
+type histogramRange struct {
+	min   float32
+	width float32 // Width of a single bin, zero if all the values are equal
+}
+
+func newHistogramRange(values []float32) histogramRange {
+	if len(values) == 0 {
+		return histogramRange{}
+	}
+
+	min, max := values[0], values[0]
+	for _, value := range values {
+		if value < min {
+			min = value
+		} else if value > max {
+			max = value
+		}
+	}
+
+	return histogramRange{
+		min:   min,
+		width: (max - min) / histogramBins,
+	}
+}
+
+// Count values by histogram bins
+func (b histogramRange) count(values []float32) []int {
+	ret := make([]int, histogramBins)
+	for _, value := range values {
+		ret[b.bin(value)]++
+	}
+
+	return ret
+}
+
+// Bin of the value, values out of the range fall into the first or the last bin
+func (b histogramRange) bin(value float32) int {
+	if b.width == 0 {
+		return 0
+	}
+
+	bin := int((value - b.min) / b.width)
+	if bin >= histogramBins {
+		return histogramBins - 1
+	} else if bin < 0 {
+		return 0
+	}
+
+	return bin
+}
@@ -0,0 +1,70 @@
+package coloring
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogramMappingSpreadsValues(t *testing.T) {
+	// most of the values are crowded at the start of the range
+	values := make([]float32, 0, 1000)
+	for i := 0; i < 900; i++ {
+		values = append(values, 0.01)
+	}
+	for i := 0; i < 100; i++ {
+		values = append(values, 0.5)
+	}
+
+	mapFunc := NewHistogramMapping(TransferLinear).Build(values)
+
+	if got := mapFunc(0.01); got < 0.4 || got > 0.5 {
+		t.Errorf("crowded value mapped to %f, expected the middle of the palette", got)
+	}
+
+	if got := mapFunc(0.5); got < 0.9 {
+		t.Errorf("rare value mapped to %f, expected the end of the palette", got)
+	}
+}
+
+func TestRankMapping(t *testing.T) {
+	values := []float32{0.1, 0.1, 0.1, 0.2, 0.9}
+
+	mapFunc := NewRankMapping(TransferLinear).Build(values)
+
+	expected := map[float32]float32{0.1: 0, 0.2: 0.5, 0.9: 1}
+	for value, position := range expected {
+		if got := mapFunc(value); got != position {
+			t.Errorf("value %f mapped to %f, expected %f", value, got, position)
+		}
+	}
+}
+
+func TestMappingsSpreadClusteredValues(t *testing.T) {
+	// deep zooms with a high iterations limit give values crowded in a narrow range
+	values := make([]float32, 0, 1001)
+	for i := 0; i <= 1000; i++ {
+		values = append(values, 0.2+0.01*float32(i)/1000)
+	}
+
+	for _, mapping := range []Mapping{NewHistogramMapping(TransferLinear), NewRankMapping(TransferLinear)} {
+		mapFunc := mapping.Build(values)
+
+		expected := map[float32]float32{0.2: 0, 0.2025: 0.25, 0.205: 0.5, 0.2075: 0.75, 0.21: 1}
+		for value, position := range expected {
+			if got := mapFunc(value); math.Abs(float64(got-position)) > 0.01 {
+				t.Errorf("%T: value %f mapped to %f, expected %f", mapping, value, got, position)
+			}
+		}
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	for _, transfer := range []Transfer{TransferLinear, TransferSqrt, TransferLog} {
+		if got := transfer.apply(0); got != 0 {
+			t.Errorf("transfer %d: 0 mapped to %f", transfer, got)
+		}
+		if got := transfer.apply(1); got < 0.999 || got > 1.001 {
+			t.Errorf("transfer %d: 1 mapped to %f", transfer, got)
+		}
+	}
+}
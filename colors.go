@@ -0,0 +1,373 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"mandelbrot/coloring"
+	"mandelbrot/fractal"
+	"mandelbrot/fractal/mandelbrot"
+	"mandelbrot/palette"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Create coloring by its name
+func newColoring(name string, density float64) (fractal.Coloring, error) {
+	switch name {
+	case "escape":
+		return coloring.NewEscapeTime(), nil
+	case "smooth":
+		return coloring.NewSmoothEscapeTime(), nil
+	case "stripe":
+		if density == 0 {
+			density = coloring.DefaultStripeDensity
+		}
+		return coloring.NewStripeAverage(density), nil
+	case "tia":
+		if density == 0 {
+			density = coloring.DefaultTIADensity
+		}
+		return coloring.NewTriangleInequality(density), nil
+	case "binary":
+		return coloring.NewBinaryDecomposition(), nil
+	case "angle":
+		return coloring.NewExternalAngle(), nil
+	case "flat":
+		return coloring.NewFlat(0.5), nil
+	default:
+		return nil, fmt.Errorf("unknown coloring: %s", name)
+	}
+}
+
+// Create palette mapping by its name
+func newMapping(name string, transfer coloring.Transfer) (coloring.Mapping, error) {
+	switch name {
+	case "linear":
+		return coloring.NewLinearMapping(transfer), nil
+	case "histogram":
+		return coloring.NewHistogramMapping(transfer), nil
+	case "rank":
+		return coloring.NewRankMapping(transfer), nil
+	default:
+		return nil, fmt.Errorf("unknown mapping: %s", name)
+	}
+}
+
+// Parse transfer function name
+func newTransfer(name string) (coloring.Transfer, error) {
+	switch name {
+	case "linear":
+		return coloring.TransferLinear, nil
+	case "sqrt":
+		return coloring.TransferSqrt, nil
+	case "log":
+		return coloring.TransferLog, nil
+	default:
+		return 0, fmt.Errorf("unknown transfer function: %s", name)
+	}
+}
+
+// Create mapping with transfer function by their names
+func newMappingTransfer(mappingName, transferName string) (coloring.Mapping, error) {
+	transfer, err := newTransfer(transferName)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMapping(mappingName, transfer)
+}
+
+// Load built-in palette by name or palette file by path
+func loadGradient(name string) (*palette.Gradient, error) {
+	builtin, err := palette.GetBuiltin(name)
+	if err == nil {
+		return builtin.Gradient(), nil
+	}
+
+	// file format errors are only meaningful when there is a file
+	if _, statErr := os.Stat(name); os.IsNotExist(statErr) {
+		return nil, err
+	}
+
+	return palette.Load(name)
+}
+
+// Create gradient from stops string and color space name
+func newGradient(stopsStr, spaceStr string) (*palette.Gradient, error) {
+	stops, err := palette.ParseStops(stopsStr)
+	if err != nil {
+		return nil, err
+	}
+
+	space, err := palette.ParseSpace(spaceStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := palette.NewGradient(space, palette.ModeClamp)
+	for _, stop := range stops {
+		ret.AddStop(stop.Position, stop.Color)
+	}
+
+	return ret, nil
+}
+
+// layerFlags collects repeated -layer flags
+type layerFlags []string
+
+func (f *layerFlags) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *layerFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Parse layer specification like "coloring=stripe,palette=viridis,opacity=0.5,blend=overlay"
+// and add the layer to the colorizer. Layers without a palette get the default one of the options
+func (o *colorOptions) addLayer(colorizer *coloring.Colorizer, spec string) error {
+	params := map[string]string{
+		"coloring": "escape",
+		"density":  "0",
+		"mapping":  "linear",
+		"transfer": "linear",
+		"lighting": "false",
+		"opacity":  "1",
+		"blend":    "normal",
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid layer %q: key=value expected", spec)
+		}
+		if _, ok := params[parts[0]]; !ok && parts[0] != "palette" {
+			return fmt.Errorf("invalid layer %q: unknown key %s", spec, parts[0])
+		}
+		params[parts[0]] = parts[1]
+	}
+
+	density, err := strconv.ParseFloat(params["density"], 64)
+	if err != nil {
+		return fmt.Errorf("invalid layer %q: %v", spec, err)
+	}
+
+	opacity, err := strconv.ParseFloat(params["opacity"], 64)
+	if err != nil {
+		return fmt.Errorf("invalid layer %q: %v", spec, err)
+	}
+
+	lighting, err := strconv.ParseBool(params["lighting"])
+	if err != nil {
+		return fmt.Errorf("invalid layer %q: %v", spec, err)
+	}
+
+	blend, err := coloring.ParseBlendMode(params["blend"])
+	if err != nil {
+		return fmt.Errorf("invalid layer %q: %v", spec, err)
+	}
+
+	var gradient *palette.Gradient
+	if name, ok := params["palette"]; ok {
+		if gradient, err = loadGradient(name); err != nil {
+			return fmt.Errorf("invalid layer %q: %v", spec, err)
+		}
+	}
+	pal, err := o.BuildPalette(gradient)
+	if err != nil {
+		return err
+	}
+
+	layerColoring, err := newColoring(params["coloring"], density)
+	if err != nil {
+		return fmt.Errorf("invalid layer %q: %v", spec, err)
+	}
+
+	mapping, err := newMappingTransfer(params["mapping"], params["transfer"])
+	if err != nil {
+		return fmt.Errorf("invalid layer %q: %v", spec, err)
+	}
+
+	layer := coloring.NewColorizer(layerColoring, pal)
+	layer.SetMapping(mapping)
+	if lighting {
+		layer.SetShadings(coloring.NewLighting(coloring.DefaultLightAngle, coloring.DefaultLightHeight, 1))
+	}
+
+	colorizer.AddLayer(layer, opacity, blend)
+
+	return nil
+}
+
+// colorOptions select coloring, palette and shadings.
+// They are shared by the viewer, headless commands and job files
+type colorOptions struct {
+	Coloring    string     `json:"coloring"`
+	Density     float64    `json:"density"`
+	FieldLines  int        `json:"field_lines"`
+	Lighting    bool       `json:"lighting"`
+	LightAngle  float64    `json:"light_angle"`
+	LightHeight float64    `json:"light_height"`
+	Mapping     string     `json:"mapping"`
+	Transfer    string     `json:"transfer"`
+	Layers      layerFlags `json:"layers"`
+
+	Palette         string  `json:"palette"`
+	Cosine          string  `json:"cosine"`
+	Extract         string  `json:"extract_palette"`
+	ExtractColors   int     `json:"extract_colors"`
+	ExtractMethod   string  `json:"extract_method"`
+	Gradient        string  `json:"gradient"`
+	GradientSpace   string  `json:"gradient_space"`
+	GradientMode    string  `json:"gradient_mode"`
+	GradientRepeats float64 `json:"gradient_repeats"`
+	PaletteSize     int     `json:"palette_size"`
+}
+
+func newColorOptions() colorOptions {
+	return colorOptions{
+		Coloring:        "escape",
+		LightAngle:      coloring.DefaultLightAngle,
+		LightHeight:     coloring.DefaultLightHeight,
+		Mapping:         "linear",
+		Transfer:        "linear",
+		ExtractColors:   8,
+		ExtractMethod:   "kmeans",
+		GradientSpace:   "oklab",
+		GradientMode:    "repeat",
+		GradientRepeats: 1,
+		PaletteSize:     256,
+	}
+}
+
+// Register options in the flag set, current values are used as defaults
+func (o *colorOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.Coloring, "coloring", o.Coloring, "select coloring: escape, smooth, stripe, tia, binary, angle or flat")
+	fs.Float64Var(&o.Density, "density", o.Density, "stripe frequency or tia palette repeats, 0 for default")
+	fs.IntVar(&o.FieldLines, "field-lines", o.FieldLines, "number of field lines drawn over the palette, 0 to disable")
+	fs.BoolVar(&o.Lighting, "lighting", o.Lighting, "shade the exterior as a lit 3D surface")
+	fs.Float64Var(&o.LightAngle, "light-angle", o.LightAngle, "light direction, degrees")
+	fs.Float64Var(&o.LightHeight, "light-height", o.LightHeight, "light elevation over the image plane")
+	fs.StringVar(&o.Mapping, "mapping", o.Mapping, "select palette mapping: linear, histogram or rank")
+	fs.StringVar(&o.Transfer, "transfer", o.Transfer, "select transfer function: linear, sqrt or log")
+	fs.Var(&o.Layers, "layer", "add coloring layer, may be repeated. Format: key=value,... with keys "+
+		"coloring, density, palette, mapping, transfer, lighting (true/false), opacity, blend (normal, multiply, screen, overlay, softlight)")
+
+	fs.StringVar(&o.Palette, "palette", o.Palette, "built-in palette name or palette file: .map, .ggr, .ugr, .csv or .json")
+	fs.StringVar(&o.Cosine, "cosine", o.Cosine, "cosine palette coefficients a:b:c:d, each one is r,g,b")
+	fs.StringVar(&o.Extract, "extract-palette", o.Extract, "extract palette from PNG or JPEG image, use with -save-palette to store it")
+	fs.IntVar(&o.ExtractColors, "extract-colors", o.ExtractColors, "number of colors extracted by -extract-palette")
+	fs.StringVar(&o.ExtractMethod, "extract-method", o.ExtractMethod, "color quantizer of -extract-palette: kmeans or median-cut")
+	fs.StringVar(&o.Gradient, "gradient", o.Gradient, "gradient stops like 0:#000764,0.5:#ffffff,1:#000764, grayscale palette if empty")
+	fs.StringVar(&o.GradientSpace, "gradient-space", o.GradientSpace, "interpolation color space of -gradient: rgb, oklab or lab")
+	fs.StringVar(&o.GradientMode, "gradient-mode", o.GradientMode, "gradient mode: clamp, repeat or mirror")
+	fs.Float64Var(&o.GradientRepeats, "gradient-repeats", o.GradientRepeats, "how many times the gradient repeats over the palette")
+	fs.IntVar(&o.PaletteSize, "palette-size", o.PaletteSize, "number of palette colors")
+}
+
+// Mode returns selected gradient mode
+func (o *colorOptions) Mode() (palette.Mode, error) {
+	return palette.ParseMode(o.GradientMode)
+}
+
+// BuildGradient returns selected gradient, nil if the default grayscale palette is used
+func (o *colorOptions) BuildGradient() (*palette.Gradient, error) {
+	var ret *palette.Gradient
+	var err error
+
+	if o.Palette != "" {
+		ret, err = loadGradient(o.Palette)
+	} else if o.Cosine != "" {
+		var cosine *palette.Cosine
+		cosine, err = palette.ParseCosine(o.Cosine)
+		if err == nil {
+			ret = cosine.Gradient()
+		}
+	} else if o.Extract != "" {
+		var quantizer palette.Quantizer
+		quantizer, err = palette.ParseQuantizer(o.ExtractMethod)
+		if err == nil {
+			ret, err = palette.ExtractFile(o.Extract, o.ExtractColors, quantizer)
+		}
+	} else if o.Gradient != "" {
+		ret, err = newGradient(o.Gradient, o.GradientSpace)
+	}
+	if err != nil || ret == nil {
+		return nil, err
+	}
+
+	mode, err := o.Mode()
+	if err != nil {
+		return nil, err
+	}
+
+	ret.SetMode(mode)
+	ret.SetRepeats(o.GradientRepeats)
+
+	return ret, nil
+}
+
+// BuildPalette samples the gradient, grayscale palette is used if gradient is nil
+func (o *colorOptions) BuildPalette(gradient *palette.Gradient) (color.Palette, error) {
+	if o.PaletteSize <= 0 {
+		return nil, fmt.Errorf("invalid palette size %d", o.PaletteSize)
+	}
+
+	if gradient == nil {
+		return palette.CreatePaletteGrayscaleRecursive(o.PaletteSize), nil
+	}
+
+	return gradient.Palette(o.PaletteSize), nil
+}
+
+// BuildColorizer creates colorizer with the selected coloring, shadings and layers
+func (o *colorOptions) BuildColorizer(pal color.Palette) (*coloring.Colorizer, error) {
+	c, err := newColoring(o.Coloring, o.Density)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := newMappingTransfer(o.Mapping, o.Transfer)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := coloring.NewColorizer(c, pal)
+	ret.SetMapping(mapping)
+
+	var shadings []fractal.Shading
+	if o.Lighting {
+		shadings = append(shadings, coloring.NewLighting(o.LightAngle, o.LightHeight, coloring.DefaultLightStrength))
+	}
+	if o.FieldLines > 0 {
+		shadings = append(shadings, coloring.NewFieldLines(o.FieldLines, coloring.DefaultFieldLinesWidth, color.RGBA{A: 255}))
+	}
+	ret.SetShadings(shadings...)
+
+	for _, spec := range o.Layers {
+		if err := o.addLayer(ret, spec); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// Create generator by its name, zero iterations select the default limit
+func newGenerator(name string, iterations int) (fractal.Generator, error) {
+	if iterations <= 0 {
+		iterations = mandelbrot.DefaultIterations
+	}
+
+	switch name {
+	case "float64":
+		return mandelbrot.NewFloat64(iterations, mandelbrot.DefaultThreshold), nil
+	case "big":
+		return mandelbrot.NewBig(iterations, mandelbrot.DefaultThreshold), nil
+	default:
+		return nil, fmt.Errorf("unknown generator: %s", name)
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"mandelbrot/coloring"
+	"mandelbrot/fractal"
+	"net/http"
+	"net/rpc"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultDistributedTile     = 256
+	DefaultDistributedTimeout  = 5 * time.Minute
+	DefaultDistributedAttempts = 3
+
+	// Worker is dropped after this number of failures in a row
+	distributedWorkerFailures = 3
+	// Delay before reconnecting to a failed worker
+	distributedRetryDelay = time.Second
+)
+
+// TileArgs is a tile requested from a worker
+type TileArgs struct {
+	Options string          // Render options of the whole image as JSON, like in batch job files
+	Rect    image.Rectangle // Tile bounds within the whole image
+}
+
+// TileReply is a rendered tile
+type TileReply struct {
+	PNG []byte
+}
+
+// RenderWorker renders tiles for the coordinator over net/rpc
+type RenderWorker struct {
+	mu   sync.Mutex
+	jobs map[string]*workerJob // Jobs by their options, only the latest ones are kept
+}
+
+// workerJob is prepared once for all the tiles of an image
+type workerJob struct {
+	once      sync.Once
+	err       error
+	opts      renderOptions
+	state     *State
+	colorizer *coloring.Colorizer
+	used      time.Time // Guarded by the worker mutex
+}
+
+// Number of jobs kept by a worker
+const workerJobs = 4
+
+// Get prepared job of the options or prepare it. Tiles of other jobs are rendered meanwhile
+func (w *RenderWorker) job(options string) (*workerJob, error) {
+	w.mu.Lock()
+	job, ok := w.jobs[options]
+	if !ok {
+		if len(w.jobs) >= workerJobs {
+			var oldest string
+			for key, job := range w.jobs {
+				if oldest == "" || job.used.Before(w.jobs[oldest].used) {
+					oldest = key
+				}
+			}
+			delete(w.jobs, oldest)
+		}
+
+		job = &workerJob{}
+		w.jobs[options] = job
+	}
+	job.used = time.Now()
+	w.mu.Unlock()
+
+	job.once.Do(func() {
+		job.err = job.prepare(options)
+	})
+
+	return job, job.err
+}
+
+// Parse render options and calibrate colors of the job
+func (j *workerJob) prepare(options string) error {
+	j.opts = newRenderOptions()
+	if err := json.Unmarshal([]byte(options), &j.opts); err != nil {
+		return errors.Wrap(err, "render options")
+	}
+
+	var err error
+	j.state, err = j.opts.State()
+	if err != nil {
+		return err
+	}
+
+	var generator fractal.Generator
+	generator, j.colorizer, err = j.opts.build()
+	if err != nil {
+		return err
+	}
+
+	// every worker calibrates colors by the same preview of the whole image, so tiles of all the workers match.
+	// Colors of linear mappings don't depend on other pixels, they need no preview
+	if !j.colorizer.NeedsCalibration() {
+		return nil
+	}
+
+	preview, err := previewState(j.state)
+	if err != nil {
+		return err
+	}
+	j.colorizer.Calibrate(generateField(nil, generator, preview, j.colorizer.Options(), func(float32) {}))
+
+	return nil
+}
+
+// RenderTile renders the tile as PNG
+func (w *RenderWorker) RenderTile(args *TileArgs, reply *TileReply) error {
+	started := time.Now()
+
+	job, err := w.job(args.Options)
+	if err != nil {
+		return err
+	}
+
+	if !args.Rect.In(image.Rect(0, 0, job.opts.Width, job.opts.Height)) || args.Rect.Empty() {
+		return fmt.Errorf("tile %v is out of the image", args.Rect)
+	}
+
+	state, err := subviewState(job.state, args.Rect)
+	if err != nil {
+		return err
+	}
+
+	// generators keep settings between calls, so every tile gets its own one
+	generator, err := newGenerator(job.opts.Generator, job.opts.Iterations)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, renderImage(nil, generator, job.colorizer, state, func(float32) {})); err != nil {
+		return err
+	}
+	reply.PNG = buf.Bytes()
+
+	log.Printf("tile %v in %s", args.Rect, time.Since(started).Round(time.Millisecond))
+
+	return nil
+}
+
+// Create HTTP handler serving a render worker over net/rpc
+func newWorkerHandler() (http.Handler, error) {
+	server := rpc.NewServer()
+	if err := server.Register(&RenderWorker{jobs: map[string]*workerJob{}}); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(rpc.DefaultRPCPath, server)
+
+	return mux, nil
+}
+
+// worker subcommand: render tiles for the distribute subcommand
+func workerCommand(args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:9001", "listen address")
+	_ = fs.Parse(args)
+
+	handler, err := newWorkerHandler()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Worker is listening at %s", *addr)
+
+	return http.ListenAndServe(*addr, handler)
+}
+
+// distributedTile is a tile of the image queued for rendering
+type distributedTile struct {
+	rect     image.Rectangle
+	attempts int
+}
+
+// distributedResult is a rendered tile or the error which stops rendering
+type distributedResult struct {
+	tile   *distributedTile
+	img    image.Image
+	worker string
+	err    error
+}
+
+// Split image into tiles in row order
+func splitTiles(width, height, size int) []*distributedTile {
+	var ret []*distributedTile
+	for y := 0; y < height; y += size {
+		for x := 0; x < width; x += size {
+			ret = append(ret, &distributedTile{
+				rect: image.Rect(x, y, x+size, y+size).Intersect(image.Rect(0, 0, width, height)),
+			})
+		}
+	}
+
+	return ret
+}
+
+// Render tile on the worker, a call taking longer than the timeout fails
+func renderRemoteTile(client *rpc.Client, args *TileArgs, timeout time.Duration) (image.Image, error) {
+	var reply TileReply
+	call := client.Go("RenderWorker.RenderTile", args, &reply, make(chan *rpc.Call, 1))
+
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return nil, call.Error
+		}
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("tile is not rendered in %s", timeout)
+	}
+
+	img, err := png.Decode(bytes.NewReader(reply.PNG))
+	if err != nil {
+		return nil, errors.Wrap(err, "decode tile")
+	}
+	if img.Bounds().Dx() != args.Rect.Dx() || img.Bounds().Dy() != args.Rect.Dy() {
+		return nil, fmt.Errorf("tile of size %v expected, got %v", args.Rect.Size(), img.Bounds().Size())
+	}
+
+	return img, nil
+}
+
+// Take tiles from the queue and render them on the worker until the queue is closed.
+// A failed tile goes back to the queue to be rendered by any worker. Only errors returned
+// by the worker count as tile attempts, connection failures and timeouts count against
+// the worker, and the worker failing several times in a row is dropped
+func runRemoteWorker(
+	addr string,
+	options string,
+	queue chan *distributedTile,
+	results chan<- distributedResult,
+	timeout time.Duration,
+	attempts int,
+) {
+	var client *rpc.Client
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+	}()
+
+	failures := 0
+	for tile := range queue {
+		var img image.Image
+		var err error
+
+		if client == nil {
+			client, err = rpc.DialHTTP("tcp", addr)
+		}
+		if err == nil {
+			img, err = renderRemoteTile(client, &TileArgs{Options: options, Rect: tile.rect}, timeout)
+		}
+
+		if err == nil {
+			failures = 0
+			results <- distributedResult{tile: tile, img: img, worker: addr}
+			continue
+		}
+
+		log.Printf("worker %s failed tile %v: %v", addr, tile.rect, err)
+
+		if _, ok := err.(rpc.ServerError); ok {
+			tile.attempts++
+			if tile.attempts >= attempts {
+				results <- distributedResult{tile: tile, err: errors.Wrapf(err, "tile %v failed %d times", tile.rect, tile.attempts)}
+				return
+			}
+			queue <- tile
+			continue
+		}
+		queue <- tile
+
+		// connection may be broken, it is opened again for the next tile
+		if client != nil {
+			client.Close()
+			client = nil
+		}
+
+		failures++
+		if failures >= distributedWorkerFailures {
+			log.Printf("worker %s is dropped after %d failures", addr, failures)
+			return
+		}
+		time.Sleep(distributedRetryDelay)
+	}
+}
+
+// distribute subcommand: render image in tiles on worker processes and assemble it
+func distributeCommand(args []string) error {
+	fs := flag.NewFlagSet("distribute", flag.ExitOnError)
+	workersStr := fs.String("workers", "localhost:9001", "comma separated worker addresses")
+	perWorker := fs.Int("per-worker", 2, "tiles rendered by a worker at once")
+	tileSize := fs.Int("tile", DefaultDistributedTile, "tile size in pixels")
+	timeout := fs.Duration("timeout", DefaultDistributedTimeout, "tile render time limit, slower tiles are given to another worker")
+	attempts := fs.Int("attempts", DefaultDistributedAttempts, "rendering stops when workers return errors for a tile this number of times")
+	output := fs.String("o", "-", "output file, - for stdout")
+	format := fs.String("format", "", "output format: png or jpeg, selected by the output file extension if empty")
+	quality := fs.Int("quality", DefaultJPEGQuality, "JPEG quality, 1-100")
+	opts := newRenderOptions()
+	opts.register(fs)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: %s distribute -workers host:port,... [options]\n"+
+			"Workers are started with: %s worker -addr host:port\n", os.Args[0], os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *perWorker < 1 || *tileSize < 1 || *attempts < 1 || *timeout <= 0 {
+		return errors.New("per-worker, tile, attempts and timeout must be positive")
+	}
+
+	var workers []string
+	for _, addr := range strings.Split(*workersStr, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			workers = append(workers, addr)
+		}
+	}
+	if len(workers) == 0 {
+		return errors.New("no workers given")
+	}
+
+	// options are checked before they are sent to the workers
+	if _, err := opts.State(); err != nil {
+		return err
+	}
+	if _, _, err := opts.build(); err != nil {
+		return err
+	}
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+
+	tiles := splitTiles(opts.Width, opts.Height, *tileSize)
+	queue := make(chan *distributedTile, len(tiles))
+	for _, tile := range tiles {
+		queue <- tile
+	}
+	results := make(chan distributedResult, len(tiles))
+
+	wg := sync.WaitGroup{}
+	for _, addr := range workers {
+		for i := 0; i < *perWorker; i++ {
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+				runRemoteWorker(addr, string(options), queue, results, *timeout, *attempts)
+			}(addr)
+		}
+	}
+
+	allDropped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allDropped)
+	}()
+
+	started := time.Now()
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	for done := 0; done < len(tiles); {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				return r.err
+			}
+
+			draw.Draw(img, r.tile.rect, r.img, r.img.Bounds().Min, draw.Src)
+			done++
+			_, _ = fmt.Fprintf(os.Stderr, "[%d/%d] tile %v by %s\n", done, len(tiles), r.tile.rect, r.worker)
+		case <-allDropped:
+			// workers may have sent results right before they were dropped
+			if len(results) == 0 {
+				return fmt.Errorf("all workers are dropped, %d of %d tiles are rendered", done, len(tiles))
+			}
+		}
+	}
+	close(queue)
+
+	if err := writeImage(*output, img, *format, *quality); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Rendered %dx%d on %d workers in %s\n",
+		opts.Width, opts.Height, len(workers), time.Since(started).Round(time.Millisecond))
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func startTestWorker(t *testing.T) *httptest.Server {
+	handler, err := newWorkerHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(handler)
+}
+
+func TestDistributedTileReassigned(t *testing.T) {
+	live := startTestWorker(t)
+	defer live.Close()
+
+	dead := startTestWorker(t)
+	deadAddr := dead.Listener.Addr().String()
+	dead.Close()
+
+	opts := newRenderOptions()
+	opts.Width, opts.Height = 64, 32
+	opts.Iterations = 100
+	options, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tile := &distributedTile{rect: image.Rect(32, 0, 64, 32)}
+	queue := make(chan *distributedTile, 1)
+	queue <- tile
+	results := make(chan distributedResult, 1)
+
+	// the killed worker gives the tile back on every failure until it is dropped,
+	// connection failures are not tile attempts, so the single attempt is not used
+	runRemoteWorker(deadAddr, string(options), queue, results, time.Minute, 1)
+	if len(results) != 0 || len(queue) != 1 || tile.attempts != 0 {
+		t.Fatalf("tile is not given back: %d results, %d queued, %d attempts", len(results), len(queue), tile.attempts)
+	}
+
+	go runRemoteWorker(live.Listener.Addr().String(), string(options), queue, results, time.Minute, 1)
+	r := <-results
+	close(queue)
+
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.worker != live.Listener.Addr().String() || r.img.Bounds().Size() != tile.rect.Size() {
+		t.Errorf("tile of %v rendered by %s, expected %v by %s",
+			r.img.Bounds().Size(), r.worker, tile.rect.Size(), live.Listener.Addr().String())
+	}
+}
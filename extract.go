@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mandelbrot/palette"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// extract subcommand: extract an ordered gradient from colors of a PNG or JPEG image and save it as a palette file
+func extractCommand(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	count := fs.Int("colors", 8, "number of extracted colors")
+	method := fs.String("method", "kmeans", "color quantizer: kmeans or median-cut")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: %s extract [options] <image> <palette>\n"+
+			"Palette format is selected by the extension: .map, .ggr, .ugr, .csv or .json\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// fail before the extraction if the palette can't be saved
+	if _, err := palette.FormatByPath(fs.Arg(1)); err != nil {
+		return err
+	}
+
+	quantizer, err := palette.ParseQuantizer(*method)
+	if err != nil {
+		return err
+	}
+
+	gradient, err := palette.ExtractFile(fs.Arg(0), *count, quantizer)
+	if err != nil {
+		return errors.Wrap(err, fs.Arg(0))
+	}
+
+	return palette.Save(fs.Arg(1), gradient)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"mandelbrot/fieldcache"
+	"mandelbrot/fractal"
+	"math/big"
+	"os"
+	"path/filepath"
+)
+
+// Default limit of the field cache size, megabytes
+const DefaultFieldCacheSize = 1024
+
+// cacheOptions select where generated fields are cached
+type cacheOptions struct {
+	Dir  string
+	Size int // Megabytes, zero disables caching
+}
+
+// Cache options with the default directory and the size limit in megabytes.
+// The viewer caches fields by default, headless commands only when the size is given
+func newCacheOptions(size int) cacheOptions {
+	dir := ""
+	if userDir, err := os.UserCacheDir(); err == nil {
+		dir = filepath.Join(userDir, "mandelbrot", "fields")
+	}
+
+	return cacheOptions{Dir: dir, Size: size}
+}
+
+func (o *cacheOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.Dir, "cache-dir", o.Dir, "directory of cached fields, revisited views are not generated again")
+	fs.IntVar(&o.Size, "cache-size", o.Size, "size limit of cached fields in megabytes, least recently used ones are removed; 0 disables caching")
+}
+
+// Open the cache, nil is returned when caching is disabled
+func (o *cacheOptions) open() (*fieldcache.Cache, error) {
+	if o.Size <= 0 || o.Dir == "" {
+		return nil, nil
+	}
+
+	return fieldcache.New(o.Dir, int64(o.Size)<<20)
+}
+
+// Value written exactly along with its precision
+func exactText(f *big.Float) string {
+	return fmt.Sprintf("%s/%d", f.Text('p', 0), f.Prec())
+}
+
+// Key of the field generated for the state, empty if the generator can not describe its settings
+func fieldCacheKey(generator fractal.Generator, state *State, opts fractal.OrbitOptions, field *fractal.Field) string {
+	cacheable, ok := generator.(fractal.Cacheable)
+	if !ok {
+		return ""
+	}
+
+	settings := cacheable.CacheKey()
+	if settings == "" {
+		return ""
+	}
+
+	return fieldcache.Key(
+		settings,
+		fmt.Sprintf("%+v", opts),
+		fmt.Sprintf("%dx%d", field.Width, field.Height),
+		exactText(state.GetCX()),
+		exactText(state.GetCY()),
+		exactText(state.GetScale()),
+		exactText(state.GetPhysicalWidth()),
+		exactText(state.GetPhysicalHeight()),
+	)
+}
+
+// Store generated field unless generation was canceled or generator settings changed meanwhile
+func storeCachedField(cache *fieldcache.Cache, key string, generator fractal.Generator, state *State, opts fractal.OrbitOptions, field *fractal.Field) {
+	if cache == nil || key == "" || fieldCacheKey(generator, state, opts, field) != key {
+		return
+	}
+
+	if err := cache.Put(key, field); err != nil {
+		log.Printf("field is not cached: %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+// Package fieldcache keeps generated fields on disk, so revisited views are not generated again
+package fieldcache
+
+import (
+	"bufio"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mandelbrot/fractal"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	fileExt   = ".field"
+	fileMagic = "MBFIELD1"
+
+	// Size of a serialized orbit: 9 float64 pairs and values, 4 integers and the escape flag
+	orbitSize = 16 + 16 + 8 + 8 + 8 + 1 + 16 + 24 + 24
+)
+
+// Cache stores fields by their keys. Total size of the files is limited,
+// least recently used fields are removed first. Cache can be shared by several processes
+type Cache struct {
+	dir   string
+	limit int64 // Bytes
+
+	mu sync.Mutex
+}
+
+// New opens cache in the directory, it is created if needed
+func New(dir string, limit int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "create cache directory")
+	}
+
+	return &Cache{dir: dir, limit: limit}, nil
+}
+
+// Key combines all the values that affect a field into a cache key
+func Key(parts ...string) string {
+	hash := sha256.New()
+	length := make([]byte, 8)
+	for _, part := range parts {
+		// parts are prefixed by their lengths, so no part can be mistaken for several ones
+		binary.LittleEndian.PutUint64(length, uint64(len(part)))
+		_, _ = hash.Write(length)
+		_, _ = io.WriteString(hash, part)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+fileExt)
+}
+
+// Get reads the field of the key into target. Field must be of the target size
+func (c *Cache) Get(key string, target *fractal.Field) bool {
+	path := c.path(key)
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	if err := readField(f, target); err != nil {
+		return false
+	}
+
+	// modification time is the last use time for eviction
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return true
+}
+
+// Put stores the field and removes least recently used fields above the size limit
+func (c *Cache) Put(key string, field *fractal.Field) error {
+	if int64(len(field.Orbits))*orbitSize > c.limit {
+		// the field would evict everything and still not fit
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(c.dir, key+".*.part")
+	if err != nil {
+		return errors.Wrap(err, "create cache file")
+	}
+
+	err = writeField(tmp, field)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrap(err, "write cache file")
+	}
+
+	return c.evict()
+}
+
+// Remove least recently used files until the total size is within the limit
+func (c *Cache) evict() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return errors.Wrap(err, "read cache directory")
+	}
+
+	var files []os.FileInfo
+	var total int64
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), fileExt) {
+			files = append(files, e)
+			total += e.Size()
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	for _, f := range files {
+		if total <= c.limit {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "evict cache file")
+		}
+		total -= f.Size()
+	}
+
+	return nil
+}
+
+func writeField(w io.Writer, field *fractal.Field) error {
+	if _, err := io.WriteString(w, fileMagic); err != nil {
+		return err
+	}
+
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint32(size, uint32(field.Width))
+	binary.LittleEndian.PutUint32(size[4:], uint32(field.Height))
+	if _, err := w.Write(size); err != nil {
+		return err
+	}
+
+	z, _ := zlib.NewWriterLevel(w, zlib.BestSpeed)
+	buffered := bufio.NewWriterSize(z, 1<<16)
+
+	buf := make([]byte, orbitSize)
+	for i := range field.Orbits {
+		encodeOrbit(buf, &field.Orbits[i])
+		if _, err := buffered.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+
+	return z.Close()
+}
+
+func readField(r io.Reader, target *fractal.Field) error {
+	header := make([]byte, len(fileMagic)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	if string(header[:len(fileMagic)]) != fileMagic {
+		return errors.New("not a field file")
+	}
+
+	width := int(binary.LittleEndian.Uint32(header[len(fileMagic):]))
+	height := int(binary.LittleEndian.Uint32(header[len(fileMagic)+4:]))
+	if width != target.Width || height != target.Height {
+		return fmt.Errorf("field of %dx%d expected, got %dx%d", target.Width, target.Height, width, height)
+	}
+
+	z, err := zlib.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+	buffered := bufio.NewReaderSize(z, 1<<16)
+
+	// orbits are decoded aside, a broken file must not leave the target half overwritten
+	orbits := make([]fractal.Orbit, len(target.Orbits))
+	buf := make([]byte, orbitSize)
+	for i := range orbits {
+		if _, err := io.ReadFull(buffered, buf); err != nil {
+			return err
+		}
+		decodeOrbit(buf, &orbits[i])
+	}
+	copy(target.Orbits, orbits)
+
+	return nil
+}
+
+// orbitCodec writes and reads orbit values one after another
+type orbitCodec struct {
+	buf []byte
+	pos int
+}
+
+func (c *orbitCodec) putFloat(v float64) {
+	binary.LittleEndian.PutUint64(c.buf[c.pos:], math.Float64bits(v))
+	c.pos += 8
+}
+
+func (c *orbitCodec) float() float64 {
+	c.pos += 8
+	return math.Float64frombits(binary.LittleEndian.Uint64(c.buf[c.pos-8:]))
+}
+
+func (c *orbitCodec) putComplex(v complex128) {
+	c.putFloat(real(v))
+	c.putFloat(imag(v))
+}
+
+func (c *orbitCodec) complex() complex128 {
+	return complex(c.float(), c.float())
+}
+
+func (c *orbitCodec) putInt(v int) {
+	binary.LittleEndian.PutUint64(c.buf[c.pos:], uint64(v))
+	c.pos += 8
+}
+
+func (c *orbitCodec) int() int {
+	c.pos += 8
+	return int(binary.LittleEndian.Uint64(c.buf[c.pos-8:]))
+}
+
+func (c *orbitCodec) putAverage(a fractal.Average) {
+	c.putFloat(a.Sum)
+	c.putFloat(a.Last)
+	c.putInt(a.Count)
+}
+
+func (c *orbitCodec) average() fractal.Average {
+	return fractal.Average{Sum: c.float(), Last: c.float(), Count: c.int()}
+}
+
+func encodeOrbit(buf []byte, o *fractal.Orbit) {
+	c := orbitCodec{buf: buf}
+	c.putComplex(o.C)
+	c.putComplex(o.Z)
+	c.putInt(o.Iterations)
+	c.putInt(o.MaxIterations)
+	c.putFloat(o.Bailout)
+	c.buf[c.pos] = 0
+	if o.Escaped {
+		c.buf[c.pos] = 1
+	}
+	c.pos++
+	c.putComplex(o.DZ)
+	c.putAverage(o.Stripe)
+	c.putAverage(o.TIA)
+}
+
+func decodeOrbit(buf []byte, o *fractal.Orbit) {
+	c := orbitCodec{buf: buf}
+	o.C = c.complex()
+	o.Z = c.complex()
+	o.Iterations = c.int()
+	o.MaxIterations = c.int()
+	o.Bailout = c.float()
+	o.Escaped = c.buf[c.pos] == 1
+	c.pos++
+	o.DZ = c.complex()
+	o.Stripe = c.average()
+	o.TIA = c.average()
+}
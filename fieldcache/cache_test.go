@@ -0,0 +1,115 @@
+package fieldcache
+
+import (
+	"io/ioutil"
+	"mandelbrot/fractal"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testField(width, height int, seed float64) *fractal.Field {
+	field := fractal.NewField(width, height)
+	for i := range field.Orbits {
+		o := &field.Orbits[i]
+		o.C = complex(seed+float64(i), -float64(i))
+		o.Z = complex(float64(i)/3, seed)
+		o.Iterations = i * 7
+		o.MaxIterations = 1000
+		o.Bailout = 2
+		o.Escaped = i%3 == 0
+		o.DZ = complex(1e300, -1e-300)
+		o.Stripe = fractal.Average{Sum: float64(i), Last: 0.5, Count: i}
+		o.TIA = fractal.Average{Sum: seed, Last: 0.25, Count: 3}
+	}
+
+	return field
+}
+
+func TestCacheGetPut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fieldcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := New(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := Key("float64", "-0.5", "0")
+	if key == Key("float64", "-0.5", "0", "") || key == Key("float64", "-0.5\x000") {
+		t.Error("different parts give the same key")
+	}
+
+	target := fractal.NewField(10, 7)
+	if c.Get(key, target) {
+		t.Fatal("empty cache returned a field")
+	}
+
+	field := testField(10, 7, 0.125)
+	if err := c.Put(key, field); err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Get(key, target) {
+		t.Fatal("stored field is not found")
+	}
+	for i := range field.Orbits {
+		if target.Orbits[i] != field.Orbits[i] {
+			t.Fatalf("orbit %d is %+v, want %+v", i, target.Orbits[i], field.Orbits[i])
+		}
+	}
+
+	if c.Get(key, fractal.NewField(7, 10)) {
+		t.Error("field of another size is returned")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fieldcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := New(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{Key("a"), Key("b"), Key("c")}
+	for i, key := range keys {
+		if err := c.Put(key, testField(50, 50, float64(i))); err != nil {
+			t.Fatal(err)
+		}
+
+		// the first field is the least recently used one
+		used := time.Now().Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, key+fileExt), used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the second field is used, so the first one is evicted
+	if !c.Get(keys[1], fractal.NewField(50, 50)) {
+		t.Fatal("stored field is not found")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, keys[2]+fileExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.limit = 2*info.Size() + info.Size()/2
+	if err := c.evict(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []bool{false, true, true} {
+		if got := c.Get(keys[i], fractal.NewField(50, 50)); got != want {
+			t.Errorf("field %d is cached: %v, want %v", i, got, want)
+		}
+	}
+}
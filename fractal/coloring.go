@@ -0,0 +1,24 @@
+package fractal
+
+import (
+	"image/color"
+)
+
+// Coloring converts an orbit of a point into a palette value
+type Coloring interface {
+	// Options returns orbit values required by the coloring
+	Options() OrbitOptions
+
+	// Value returns palette value in range [0, 1] for the given orbit
+	Value(orbit *Orbit) float32
+}
+
+// Shading modifies palette color of a point using its orbit.
+// Shadings are applied one after another once the coloring is done
+type Shading interface {
+	// Options returns orbit values required by the shading
+	Options() OrbitOptions
+
+	// Shade returns the new color of a point
+	Shade(c color.RGBA, orbit *Orbit) color.RGBA
+}
@@ -0,0 +1,28 @@
+package fractal
+
+// Field holds collected orbits for every pixel of the rendered frame
+type Field struct {
+	Width  int
+	Height int
+	Orbits []Orbit // Orbits stored row by row
+}
+
+func NewField(width, height int) *Field {
+	return &Field{
+		Width:  width,
+		Height: height,
+		Orbits: make([]Orbit, width*height),
+	}
+}
+
+// At returns the orbit of a pixel
+func (f *Field) At(x, y int) *Orbit {
+	return &f.Orbits[y*f.Width+x]
+}
+
+// Reset forgets all collected orbits
+func (f *Field) Reset() {
+	for i := range f.Orbits {
+		f.Orbits[i] = Orbit{}
+	}
+}
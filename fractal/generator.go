@@ -1,7 +1,6 @@
 package fractal
 
 import (
-	"image"
 	"math/big"
 )
 
@@ -10,14 +9,43 @@ type DoneFunc func()
 
 // FractalGenerator defines an interface for objects that can draw fractals
 type Generator interface {
-	// target - fractal will be rendered here
+	// target - orbits of all the pixels will be collected here
 	// cx, cy, scale - center coordinates and scale
+	// opts - orbit values that must be collected
 	// reportingFunc - callback that could be called during generation
 	// doneFunc - callback that must be called once after the generation is complete
 	Generate(
-		target *image.RGBA,
+		target *Field,
 		cx, cy, scale *big.Float,
 		physicalWidth, physicalHeight *big.Float,
+		opts OrbitOptions,
 		reportingFunc ProgressReportingFunc, doneFunc DoneFunc,
 	)
 }
+
+// Rotator is a generator that can render the viewport rotated around its center
+type Rotator interface {
+	// angle - counterclockwise rotation in radians
+	SetRotation(angle float64)
+}
+
+// JuliaSetter is a generator that can render Julia sets instead of the Mandelbrot set
+type JuliaSetter interface {
+	// cx, cy - Julia set parameter, nil switches back to the Mandelbrot set
+	SetJulia(cx, cy *big.Float)
+}
+
+// Canceler is a generator which generation can be stopped before it is complete
+type Canceler interface {
+	// done - generation stops soon after the channel is closed leaving the field incomplete,
+	// doneFunc is called anyway. Nil channel never cancels
+	SetCancel(done <-chan struct{})
+}
+
+// Cacheable is a generator which fields can be cached.
+// Generators of equal keys generate equal fields for equal viewports
+type Cacheable interface {
+	// CacheKey describes all the settings affecting generated orbits,
+	// empty when the field must not be cached, like after the generation is canceled
+	CacheKey() string
+}
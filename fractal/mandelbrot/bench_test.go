@@ -1,6 +1,7 @@
 package mandelbrot
 
 import (
+	"mandelbrot/fractal"
 	"math/big"
 	"testing"
 )
@@ -54,11 +55,14 @@ func BenchmarkFloat64(b *testing.B) {
 		}
 	}
 
+	var orbit fractal.Orbit
+	var opts fractal.OrbitOptions
+
 	b.ResetTimer()
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		index := i % len(points)
-		mandelbrotComplex128(complex(points[index].x, points[index].y), 10, 3.0)
+		mandelbrotComplex128(&orbit, complex(points[index].x, points[index].y), 10, 3.0, &opts)
 	}
 	b.StopTimer()
 }
@@ -99,11 +103,14 @@ func BenchmarkBig(b *testing.B) {
 		}
 	}
 
+	var orbit fractal.Orbit
+	var opts fractal.OrbitOptions
+
 	b.ResetTimer()
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		index := i % len(points)
-		mandelbrotBig(points[index].x, points[index].y, 10, 3.0)
+		mandelbrotBig(&orbit, points[index].x, points[index].y, 10, 3.0, &opts)
 	}
 	b.StopTimer()
 }
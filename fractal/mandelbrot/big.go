@@ -1,9 +1,9 @@
 package mandelbrot
 
 import (
-	"image"
+	"fmt"
 	"mandelbrot/fractal"
-	"mandelbrot/palette"
+	"math"
 	"math/big"
 	"sync"
 	"sync/atomic"
@@ -11,8 +11,11 @@ import (
 
 // Big is a mandelbrot fractal generator that uses *big.Float numbers for calculations
 type Big struct {
-	iterations int
-	threshold  float32
+	iterations     int
+	threshold      float32
+	rotation       float64         // View rotation around the center, radians
+	juliaX, juliaY *big.Float      // Julia set parameter, nil for the Mandelbrot set
+	cancel         <-chan struct{} // Generation stops when it is closed
 }
 
 func NewBigDefault() *Big {
@@ -30,32 +33,68 @@ func NewBig(iterations int, threshold float32) *Big {
 
 var half = big.NewFloat(0.5)
 
+// SetRotation rotates rendered viewport counterclockwise around its center
+func (f *Big) SetRotation(angle float64) {
+	f.rotation = angle
+}
+
+// SetJulia switches generator to the Julia set of the parameter, nil switches back to the Mandelbrot set
+func (f *Big) SetJulia(cx, cy *big.Float) {
+	f.juliaX, f.juliaY = nil, nil
+	if cx != nil && cy != nil {
+		f.juliaX = big.NewFloat(0).Copy(cx)
+		f.juliaY = big.NewFloat(0).Copy(cy)
+	}
+}
+
+// SetCancel sets channel which closing stops generation
+func (f *Big) SetCancel(done <-chan struct{}) {
+	f.cancel = done
+}
+
+// CacheKey describes settings affecting generated orbits, it is empty after the generation is canceled
+func (f *Big) CacheKey() string {
+	if canceled(f.cancel) {
+		return ""
+	}
+
+	julia := "none"
+	if f.juliaX != nil {
+		// values are written exactly, precision affects iterations
+		julia = fmt.Sprintf("%s:%s/%d", f.juliaX.Text('p', 0), f.juliaY.Text('p', 0), f.juliaX.Prec())
+	}
+
+	return fmt.Sprintf("big iterations=%d threshold=%v rotation=%v julia=%s",
+		f.iterations, f.threshold, f.rotation, julia)
+}
+
 // Generation function
 func (f *Big) Generate(
-	target *image.RGBA,
+	target *fractal.Field,
 	cx, cy, scale *big.Float,
 	physicalWidth, physicalHeight *big.Float,
+	opts fractal.OrbitOptions,
 	reportingFunc fractal.ProgressReportingFunc,
 	doneFunc fractal.DoneFunc,
 ) {
+	// settings are copied, so they can be changed while the previous field is generated
+	rotation, juliaX, juliaY, cancel := f.rotation, f.juliaX, f.juliaY, f.cancel
+
 	go func() {
-		// Start physical x point
-		// physMinX = cx - (physWidth / 2)
-		physMinX := big.NewFloat(0).Copy(physicalWidth)
-		physMinX = physMinX.Mul(physMinX, half)
-		physMinX = physMinX.Sub(cx, physMinX)
-
-		// Start physical y point
-		// physMinY = cy - (physHeight / 2)
-		physMinY := big.NewFloat(0).Copy(physicalHeight)
-		physMinY = physMinY.Mul(physMinY, half)
-		physMinY = physMinY.Sub(cy, physMinY)
+		// Half of physical width and height, offsets from the center are counted from them
+		halfWidth := big.NewFloat(0).Copy(physicalWidth)
+		halfWidth = halfWidth.Mul(halfWidth, half)
+		halfHeight := big.NewFloat(0).Copy(physicalHeight)
+		halfHeight = halfHeight.Mul(halfHeight, half)
 
 		// Calculate pixel-to-physical scale
-		scaleX := big.NewFloat(0).SetPrec(physicalWidth.Prec()).Quo(physicalWidth, big.NewFloat(float64(target.Rect.Max.X)))
-		scaleY := big.NewFloat(0).SetPrec(physicalHeight.Prec()).Quo(physicalHeight, big.NewFloat(float64(target.Rect.Max.Y)))
+		scaleX := big.NewFloat(0).SetPrec(physicalWidth.Prec()).Quo(physicalWidth, big.NewFloat(float64(target.Width)))
+		scaleY := big.NewFloat(0).SetPrec(physicalHeight.Prec()).Quo(physicalHeight, big.NewFloat(float64(target.Height)))
+
+		sinF64, cosF64 := math.Sincos(rotation)
+		sin, cos := big.NewFloat(sinF64), big.NewFloat(cosF64)
 
-		pal := palette.CreatePaletteGrayscaleRecursive(256)
+		bailout := math.Max(float64(f.threshold), opts.Bailout)
 
 		wg := sync.WaitGroup{}
 
@@ -64,29 +103,49 @@ func (f *Big) Generate(
 		linesDonePtr := &linesDone
 
 		// (x, y) - are pixel coords
-		for y := 0; y < target.Rect.Max.Y; y++ {
-			// (physX, physY) - are physical coordinates
-			physY := big.NewFloat(float64(y)).SetPrec(cy.Prec())
-			physY = physY.Mul(physY, scaleY)
-			physY.Add(physY, physMinY)
+		for y := 0; y < target.Height; y++ {
+			// (dx, dy) - are physical offsets from the center before rotation
+			dy := big.NewFloat(float64(y)).SetPrec(cy.Prec())
+			dy = dy.Mul(dy, scaleY)
+			dy.Sub(dy, halfHeight)
 
 			wg.Add(1)
-			go func(y int, physY *big.Float) {
-				for x := 0; x < target.Rect.Max.X; x++ {
-					physX := big.NewFloat(float64(x)).SetPrec(cx.Prec())
-					physX = physX.Mul(physX, scaleX)
-					physX.Add(physX, physMinX)
-
-					// get fractal value at the point
-					value := mandelbrotBig(physX, physY, f.iterations, f.threshold)
-
-					// convert it to the color and set pixel color
-					target.Set(x, y, pal[int(float32(len(pal))*value)])
+			go func(y int, dy *big.Float) {
+				tmp := big.NewFloat(0).SetPrec(cx.Prec())
+				for x := 0; x < target.Width && !canceled(cancel); x++ {
+					dx := big.NewFloat(float64(x)).SetPrec(cx.Prec())
+					dx = dx.Mul(dx, scaleX)
+					dx.Sub(dx, halfWidth)
+
+					// (physX, physY) - are physical coordinates
+					physX := big.NewFloat(0).SetPrec(cx.Prec())
+					physY := big.NewFloat(0).SetPrec(cy.Prec())
+					if rotation == 0 {
+						physX.Add(cx, dx)
+						physY.Add(cy, dy)
+					} else {
+						// physX = cx + dx*cos - dy*sin
+						physX.Mul(dx, cos)
+						physX.Sub(physX, tmp.Mul(dy, sin))
+						physX.Add(physX, cx)
+
+						// physY = cy + dx*sin + dy*cos
+						physY.Mul(dx, sin)
+						physY.Add(physY, tmp.Mul(dy, cos))
+						physY.Add(physY, cy)
+					}
+
+					// iterate the point and collect its orbit values
+					if juliaX != nil {
+						iterateBig(target.At(x, y), physX, physY, juliaX, juliaY, f.iterations, bailout, &opts, cancel)
+					} else {
+						iterateBig(target.At(x, y), bigZero, bigZero, physX, physY, f.iterations, bailout, &opts, cancel)
+					}
 				}
 				atomic.AddInt32(linesDonePtr, 1)
-				reportingFunc(float32(atomic.LoadInt32(linesDonePtr)) / float32(target.Rect.Max.Y))
+				reportingFunc(float32(atomic.LoadInt32(linesDonePtr)) / float32(target.Height))
 				wg.Done()
-			}(y, physY)
+			}(y, dy)
 		}
 
 		wg.Wait()
@@ -95,14 +154,38 @@ func (f *Big) Generate(
 }
 
 var two = big.NewFloat(2.0)
+var bigZero = big.NewFloat(0)
 
-func mandelbrotBig(x *big.Float, y *big.Float,iterations int, threshold float32) float32 {
-	thresholdBig := big.NewFloat(float64(threshold))
+// Iterate given point and collect its orbit values.
+// Orbit values are stored as float64 approximations, which is enough for coloring
+func mandelbrotBig(orbit *fractal.Orbit, x *big.Float, y *big.Float, iterations int, bailout float64, opts *fractal.OrbitOptions) {
+	iterateBig(orbit, bigZero, bigZero, x, y, iterations, bailout, opts, nil)
+}
 
-	retX := big.NewFloat(0).SetPrec(x.Prec())
-	retY := big.NewFloat(0).SetPrec(y.Prec())
+// Iterate z -> z^2 + c starting from z = (startX, startY) with c = (x, y) and collect its orbit values.
+// Deep points take long, so iterating stops early when cancel is closed
+func iterateBig(
+	orbit *fractal.Orbit,
+	startX, startY *big.Float,
+	x *big.Float, y *big.Float,
+	iterations int, bailout float64,
+	opts *fractal.OrbitOptions,
+	cancel <-chan struct{},
+) {
+	cx, _ := x.Float64()
+	cy, _ := y.Float64()
+	orbit.Reset(complex(cx, cy), iterations, bailout)
 
-	tmp := big.NewFloat(0).SetPrec(x.Prec())
+	bailoutSquared := bailout * bailout
+
+	// Julia sets start from the pixel, which may be more precise than the parameter
+	prec := x.Prec()
+	if startX.Prec() > prec {
+		prec = startX.Prec()
+	}
+
+	retX := big.NewFloat(0).SetPrec(prec).Set(startX)
+	retY := big.NewFloat(0).SetPrec(prec).Set(startY)
 
 	xSquared := big.NewFloat(0).SetPrec(retX.Prec())
 	ySquared := big.NewFloat(0).SetPrec(retY.Prec())
@@ -111,6 +194,10 @@ func mandelbrotBig(x *big.Float, y *big.Float,iterations int, threshold float32)
 	tmp2xy := big.NewFloat(0).SetPrec(retX.Prec())
 
 	for i := 0; i < iterations; i++ {
+		if i%64 == 63 && canceled(cancel) {
+			return
+		}
+
 		// calc real part: x^2 - y^2
 		xSquared.Mul(retX, retX)
 		ySquared.Mul(retY, retY)
@@ -124,17 +211,15 @@ func mandelbrotBig(x *big.Float, y *big.Float,iterations int, threshold float32)
 		retX.Add(x, tmpSquaresDiff)
 		retY.Add(y, tmp2xy)
 
-		// calculate absolute value of complex number (retX, retY)
-		// reuse previous calculations of xSquared and ySquared
-		tmp.Add(xSquared, ySquared) // tmp <- x^2 + y^2
-		tmp.Sqrt(xSquared) // tmp <- sqrt(tmp)
-
-		abs := tmp
+		// orbit values near the bailout radius are well within float64 range,
+		// so the escape check is done on the float64 approximation
+		zx, _ := retX.Float64()
+		zy, _ := retY.Float64()
+		orbit.Step(complex(zx, zy), opts)
 
-		if abs.Cmp(thresholdBig) > 0 {
-			return float32(i) / float32(iterations)
+		if zx*zx+zy*zy > bailoutSquared {
+			orbit.Escaped = true
+			return
 		}
 	}
-
-	return 0
 }
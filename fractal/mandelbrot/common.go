@@ -12,3 +12,13 @@ const (
 	// Point does belong to mandelbrot set if value is less than threshold
 	DefaultThreshold = 4.0
 )
+
+// Check whether generation is canceled, nil channel is never closed
+func canceled(cancel <-chan struct{}) bool {
+	select {
+	case <-cancel:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,11 +1,10 @@
 package mandelbrot
 
 import (
-	"image"
+	"fmt"
 	"mandelbrot/fractal"
-	"mandelbrot/palette"
+	"math"
 	"math/big"
-	"math/cmplx"
 	"sync"
 	"sync/atomic"
 )
@@ -14,6 +13,10 @@ import (
 type Float64 struct {
 	iterations int
 	threshold  float32
+	rotation   float64    // View rotation around the center, radians
+	julia      complex128 // Julia set parameter, used when isJulia is set
+	isJulia    bool
+	cancel     <-chan struct{} // Generation stops when it is closed
 }
 
 func NewFloat64Default() *Float64 {
@@ -29,34 +32,66 @@ func NewFloat64(iterations int, threshold float32) *Float64 {
 	return ret
 }
 
+// SetRotation rotates rendered viewport counterclockwise around its center
+func (f *Float64) SetRotation(angle float64) {
+	f.rotation = angle
+}
+
+// SetJulia switches generator to the Julia set of the parameter, nil switches back to the Mandelbrot set
+func (f *Float64) SetJulia(cx, cy *big.Float) {
+	f.isJulia = cx != nil && cy != nil
+	if f.isJulia {
+		x, _ := cx.Float64()
+		y, _ := cy.Float64()
+		f.julia = complex(x, y)
+	}
+}
+
+// SetCancel sets channel which closing stops generation
+func (f *Float64) SetCancel(done <-chan struct{}) {
+	f.cancel = done
+}
+
+// CacheKey describes settings affecting generated orbits, it is empty after the generation is canceled
+func (f *Float64) CacheKey() string {
+	if canceled(f.cancel) {
+		return ""
+	}
+
+	return fmt.Sprintf("float64 iterations=%d threshold=%v rotation=%v julia=%v:%v",
+		f.iterations, f.threshold, f.rotation, f.isJulia, f.julia)
+}
+
 // Generation function
 func (f *Float64) Generate(
-	target *image.RGBA,
+	target *fractal.Field,
 	cx, cy, scale *big.Float,
 	physicalWidth, physicalHeight *big.Float,
+	opts fractal.OrbitOptions,
 	reportingFunc fractal.ProgressReportingFunc,
 	doneFunc fractal.DoneFunc,
 ) {
+	// settings are copied, so they can be changed while the previous field is generated
+	rotation, julia, isJulia, cancel := f.rotation, f.julia, f.isJulia, f.cancel
+
 	go func() {
-		x, _ := cx.Float64()
-		y, _ := cy.Float64()
+		centerX, _ := cx.Float64()
+		centerY, _ := cy.Float64()
 
 		// Calculate physical width and height
 		physWidthF64, _ := physicalWidth.Float64()
 		physHeightF64, _ := physicalHeight.Float64()
 
-		width := target.Rect.Max.X
-		height := target.Rect.Max.Y
-
-		// Scale physical bounds
-		physMinX := x - (physWidthF64 / 2)
-		physMinY := y - (physHeightF64 / 2)
+		width := target.Width
+		height := target.Height
 
 		// Calculate pixel-to-physical scale
 		scaleX := physWidthF64 / float64(width)
 		scaleY := physHeightF64 / float64(height)
 
-		pal := palette.CreatePaletteGrayscaleRecursive(256)
+		sin, cos := math.Sincos(rotation)
+
+		bailout := math.Max(float64(f.threshold), opts.Bailout)
 
 		wg := sync.WaitGroup{}
 
@@ -66,23 +101,28 @@ func (f *Float64) Generate(
 
 		// (x, y) - are pixel coords
 		for y := 0; y < height; y++ {
-			// (physX, physY) - are physical coordinates
-			physY := float64(y)*scaleY + physMinY
+			// (dx, dy) - are physical offsets from the center before rotation
+			dy := float64(y)*scaleY - physHeightF64/2
 			wg.Add(1)
-			go func(y int, physY float64) {
-				for x := 0; x < width; x++ {
-					physX := float64(x)*scaleX + physMinX
-
-					// get fractal value at the point
-					value := mandelbrotComplex128(complex(physX, physY), f.iterations, f.threshold)
-
-					// convert it to the color and set pixel color
-					target.Set(x, y, pal[int(float32(len(pal))*value)])
+			go func(y int, dy float64) {
+				for x := 0; x < width && !canceled(cancel); x++ {
+					dx := float64(x)*scaleX - physWidthF64/2
+
+					// (physX, physY) - are physical coordinates
+					physX := centerX + dx*cos - dy*sin
+					physY := centerY + dx*sin + dy*cos
+
+					// iterate the point and collect its orbit values
+					if isJulia {
+						iterateComplex128(target.At(x, y), complex(physX, physY), julia, f.iterations, bailout, &opts)
+					} else {
+						mandelbrotComplex128(target.At(x, y), complex(physX, physY), f.iterations, bailout, &opts)
+					}
 				}
 				atomic.AddInt32(linesDonePtr, 1)
 				reportingFunc(float32(atomic.LoadInt32(linesDonePtr)) / float32(height))
 				wg.Done()
-			}(y, physY)
+			}(y, dy)
 		}
 
 		wg.Wait()
@@ -90,16 +130,23 @@ func (f *Float64) Generate(
 	}()
 }
 
-// Calculate mandelbrot set value in given point
-func mandelbrotComplex128(c complex128, iterations int, threshold float32) float32 {
-	ret := complex(0, 0)
+// Iterate given point and collect its orbit values
+func mandelbrotComplex128(orbit *fractal.Orbit, c complex128, iterations int, bailout float64, opts *fractal.OrbitOptions) {
+	iterateComplex128(orbit, 0, c, iterations, bailout, opts)
+}
+
+// Iterate z -> z^2 + c starting from z and collect its orbit values
+func iterateComplex128(orbit *fractal.Orbit, z, c complex128, iterations int, bailout float64, opts *fractal.OrbitOptions) {
+	orbit.Reset(c, iterations, bailout)
+
+	bailoutSquared := bailout * bailout
 
 	for i := 0; i < iterations; i++ {
-		ret = ret*ret + c
-		if float32(cmplx.Abs(ret)) > threshold {
-			return float32(i) / float32(iterations)
+		z = z*z + c
+		orbit.Step(z, opts)
+		if real(z)*real(z)+imag(z)*imag(z) > bailoutSquared {
+			orbit.Escaped = true
+			return
 		}
 	}
-
-	return 0
 }
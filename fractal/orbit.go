@@ -0,0 +1,128 @@
+package fractal
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// OrbitOptions define which additional values are collected while iterating a point
+type OrbitOptions struct {
+	// Minimal escape radius. Averaging colorings need large radius to look smooth.
+	// Zero keeps the generator's threshold
+	Bailout float64
+
+	// Frequency of stripe average. Zero disables stripe average collection
+	StripeDensity float64
+
+	// Collect triangle inequality average
+	TIA bool
+
+	// Collect derivative dz/dc used for distance estimation
+	Derivative bool
+}
+
+// Merge combines options so that values required by both are collected
+func (o OrbitOptions) Merge(other OrbitOptions) OrbitOptions {
+	ret := o
+	ret.Bailout = math.Max(o.Bailout, other.Bailout)
+	if ret.StripeDensity == 0 {
+		ret.StripeDensity = other.StripeDensity
+	}
+	ret.TIA = o.TIA || other.TIA
+	ret.Derivative = o.Derivative || other.Derivative
+	return ret
+}
+
+// Average accumulates an average over the orbit.
+// The last added term is kept separately to interpolate between the last two iterations
+type Average struct {
+	Sum   float64
+	Last  float64
+	Count int
+}
+
+func (a *Average) Add(value float64) {
+	a.Sum += value
+	a.Last = value
+	a.Count++
+}
+
+// Smooth returns the average interpolated between the last two iterations.
+// fraction is in range [0, 1], where 1 means the average over all iterations
+func (a *Average) Smooth(fraction float64) float64 {
+	if a.Count == 0 {
+		return 0
+	}
+
+	avg := a.Sum / float64(a.Count)
+	if a.Count == 1 {
+		return avg
+	}
+
+	lastAvg := (a.Sum - a.Last) / float64(a.Count-1)
+
+	return fraction*avg + (1-fraction)*lastAvg
+}
+
+// Orbit holds values collected while iterating a single point
+type Orbit struct {
+	C             complex128 // Iterated point
+	Z             complex128 // Last orbit value
+	Iterations    int        // Number of iterations done
+	MaxIterations int        // Iterations limit
+	Bailout       float64    // Escape radius
+	Escaped       bool       // Did the orbit escape the bailout radius
+
+	DZ complex128 // Derivative dz/dc
+
+	Stripe Average // Stripe average: sin(density * arg(z))
+	TIA    Average // Triangle inequality average
+}
+
+// Reset prepares orbit for iterating a new point
+func (o *Orbit) Reset(c complex128, maxIterations int, bailout float64) {
+	*o = Orbit{
+		C:             c,
+		MaxIterations: maxIterations,
+		Bailout:       bailout,
+	}
+}
+
+// Step adds z as the next orbit value. Must be called after every iteration
+func (o *Orbit) Step(z complex128, opts *OrbitOptions) {
+	if opts.StripeDensity != 0 && o.Iterations > 0 {
+		o.Stripe.Add(0.5*math.Sin(opts.StripeDensity*cmplx.Phase(z)) + 0.5)
+	}
+
+	if opts.TIA && o.Iterations > 0 {
+		// |z(n)| lies between | |z(n-1)|^2 - |c| | and |z(n-1)|^2 + |c|
+		prevAbsSquared := real(o.Z)*real(o.Z) + imag(o.Z)*imag(o.Z)
+		absC := cmplx.Abs(o.C)
+		lower := math.Abs(prevAbsSquared - absC)
+		upper := prevAbsSquared + absC
+		if upper > lower {
+			o.TIA.Add((cmplx.Abs(z) - lower) / (upper - lower))
+		}
+	}
+
+	if opts.Derivative {
+		// dz(n) = 2 * z(n-1) * dz(n-1) + 1
+		o.DZ = 2*o.Z*o.DZ + 1
+	}
+
+	o.Z = z
+	o.Iterations++
+}
+
+// SmoothFraction returns the fractional part of the continuous iteration count in range [0, 1].
+// Used to interpolate between the last two iterations of an escaped orbit
+func (o *Orbit) SmoothFraction() float64 {
+	absZ := cmplx.Abs(o.Z)
+	if !o.Escaped || absZ <= 1 || o.Bailout <= 1 {
+		return 1
+	}
+
+	fraction := 1 + math.Log2(math.Log(o.Bailout)/math.Log(absZ))
+
+	return math.Max(0, math.Min(1, fraction))
+}
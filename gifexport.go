@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"mandelbrot/coloring"
+	"mandelbrot/palette"
+	"mandelbrot/video"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultGIFFrames = 30
+	DefaultGIFDelay  = 40 * time.Millisecond
+)
+
+// gif subcommand: animated GIF of a palette cycle over a single render or of a short zoom
+func gifCommand(args []string) error {
+	fs := flag.NewFlagSet("gif", flag.ExitOnError)
+	mode := fs.String("mode", "cycle", "animation: cycle rotates the palette, zoom flies from -from-zoom into -zoom")
+	frames := fs.Int("frames", DefaultGIFFrames, "number of frames")
+	fromCX := fs.String("from-cx", "-0.7", "center x-coordinate of the first zoom frame")
+	fromCY := fs.String("from-cy", "0", "center y-coordinate of the first zoom frame")
+	fromZoom := fs.String("from-zoom", "1", "magnification of the first zoom frame")
+	easingStr := fs.String("ease", "none", "zoom speed easing: none, in, out or inout")
+	colors := fs.Int("colors", 256, "GIF palette size, 2-256")
+	global := fs.Bool("global", false, "use one palette optimized for all frames instead of a palette per frame")
+	dither := fs.Bool("dither", false, "use Floyd-Steinberg dithering")
+	quantizerStr := fs.String("quantizer", "median-cut", "palette quantizer: median-cut or kmeans")
+	delay := fs.Duration("delay", DefaultGIFDelay, "delay between frames, GIF precision is 10ms")
+	loop := fs.Int("loop", 0, "0 loops forever, -1 plays once, N plays N+1 times")
+	output := fs.String("o", "-", "output GIF file, - for stdout")
+	opts := newRenderOptions()
+	opts.register(fs)
+	_ = fs.Parse(args)
+
+	if *frames < 1 {
+		return errors.New("at least 1 frame expected")
+	}
+
+	quantizer, err := palette.ParseQuantizer(*quantizerStr)
+	if err != nil {
+		return err
+	}
+
+	generator, colorizer, err := opts.build()
+	if err != nil {
+		return err
+	}
+
+	to, err := opts.State()
+	if err != nil {
+		return err
+	}
+
+	var render func(frame int) *image.RGBA
+	switch *mode {
+	case "cycle":
+		// the fractal is computed once, frames only shift the palette
+		field := generateField(nil, generator, to, colorizer.Options(), func(float32) {})
+		var buf coloring.Buffer
+		render = func(frame int) *image.RGBA {
+			colorizer.SetOffset(float64(frame) / float64(*frames))
+			img := image.NewRGBA(image.Rect(0, 0, field.Width, field.Height))
+			colorizer.ColorizeBuffer(field, img, &buf)
+			return img
+		}
+	case "zoom":
+		easing, err := parseEasing(*easingStr)
+		if err != nil {
+			return err
+		}
+
+		from, err := NewStateView(*fromCX, *fromCY, *fromZoom, opts.Width, opts.Height)
+		if err != nil {
+			return err
+		}
+
+		path := newZoomPath(from, to)
+		render = func(frame int) *image.RGBA {
+			t := 0.0
+			if *frames > 1 {
+				t = easing(float64(frame) / float64(*frames-1))
+			}
+			return renderImage(nil, generator, colorizer, path.At(t), func(float32) {})
+		}
+	default:
+		return fmt.Errorf("unknown gif mode: %s", *mode)
+	}
+
+	out := os.Stdout
+	if *output != "-" {
+		out, err = os.Create(*output)
+		if err != nil {
+			return errors.Wrap(err, "create gif file")
+		}
+		defer out.Close()
+	}
+
+	w, err := video.NewGIFWriter(out, opts.Width, opts.Height, video.GIFOptions{
+		Colors:    *colors,
+		Global:    *global,
+		Dither:    *dither,
+		Quantizer: quantizer,
+		Delay:     *delay,
+		LoopCount: *loop,
+	})
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	for frame := 0; frame < *frames; frame++ {
+		if err := w.WriteFrame(render(frame)); err != nil {
+			return errors.Wrapf(err, "frame %d", frame)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "[%d/%d] done\n", frame+1, *frames)
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if out != os.Stdout {
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Written %d frames in %s\n", *frames, time.Since(started).Round(time.Millisecond))
+
+	return nil
+}
@@ -20,6 +20,8 @@ func NewRenderer() *Renderer {
 }
 
 func (r *Renderer) Draw(object Drawable, x int, y int) {
+	object.GetTexture().Bind(0)
+
 	shader := object.GetShader()
 	shader.Bind()
 	shader.SetUniform1i("u_Texture", 0)
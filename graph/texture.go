@@ -6,49 +6,118 @@ import (
 	"image"
 	"image/draw"
 	"os"
+	"unsafe"
+)
+
+// TextureFormat describes how texture data is stored on GPU and passed from the application
+type TextureFormat struct {
+	internalFormat int32  // GPU storage format
+	format         uint32 // Components of the passed data
+	dataType       uint32 // Type of the passed data components
+}
+
+var (
+	// 8-bit RGBA color, data is passed as []uint8
+	TextureFormatRGBA8 = TextureFormat{internalFormat: gl.RGBA8, format: gl.RGBA, dataType: gl.UNSIGNED_BYTE}
+
+	// Single 32-bit float value, data is passed as []float32
+	TextureFormatR32F = TextureFormat{internalFormat: gl.R32F, format: gl.RED, dataType: gl.FLOAT}
 )
 
 type Texture struct {
 	rendererId uint32
+	target     uint32 // gl.TEXTURE_1D or gl.TEXTURE_2D
+	format     TextureFormat
 
 	width  int
 	height int
 }
 
 func NewTexture(width int, height int) *Texture {
+	return NewTextureFormat(width, height, TextureFormatRGBA8)
+}
+
+// NewTextureFormat creates 2D texture of the given data format
+func NewTextureFormat(width int, height int, format TextureFormat) *Texture {
+	return newTexture(gl.TEXTURE_2D, width, height, format)
+}
+
+// NewTexture1D creates 1D texture of the given data format
+func NewTexture1D(width int, format TextureFormat) *Texture {
+	return newTexture(gl.TEXTURE_1D, width, 1, format)
+}
+
+func newTexture(target uint32, width int, height int, format TextureFormat) *Texture {
 	ret := &Texture{
+		target: target,
+		format: format,
 		width:  width,
 		height: height,
 	}
 
 	gl.GenTextures(1, &ret.rendererId)
 	ret.Bind(0)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	ret.SetFilter(gl.LINEAR)
+	ret.SetWrap(gl.CLAMP_TO_EDGE)
 
 	return ret
 }
 
+// SetFilter sets minifying and magnifying filter: gl.LINEAR or gl.NEAREST
+func (t *Texture) SetFilter(filter int32) {
+	t.Bind(0)
+	gl.TexParameteri(t.target, gl.TEXTURE_MIN_FILTER, filter)
+	gl.TexParameteri(t.target, gl.TEXTURE_MAG_FILTER, filter)
+}
+
+// SetWrap sets wrapping of texture coordinates outside of range [0, 1]: gl.CLAMP_TO_EDGE, gl.REPEAT, etc
+func (t *Texture) SetWrap(wrap int32) {
+	t.Bind(0)
+	gl.TexParameteri(t.target, gl.TEXTURE_WRAP_S, wrap)
+	if t.target == gl.TEXTURE_2D {
+		gl.TexParameteri(t.target, gl.TEXTURE_WRAP_T, wrap)
+	}
+}
+
+// SetImageData uploads texture data of 8-bit formats
 func (t *Texture) SetImageData(data []uint8) {
+	t.setData(gl.Ptr(data))
+}
+
+// SetFloatData uploads texture data of float formats
+func (t *Texture) SetFloatData(data []float32) {
+	t.setData(gl.Ptr(data))
+}
+
+func (t *Texture) setData(data unsafe.Pointer) {
 	t.Bind(0)
 
+	if t.target == gl.TEXTURE_1D {
+		gl.TexImage1D(
+			gl.TEXTURE_1D,
+			0,
+			t.format.internalFormat,
+			int32(t.width),
+			0,
+			t.format.format,
+			t.format.dataType,
+			data)
+		return
+	}
+
 	gl.TexImage2D(
 		gl.TEXTURE_2D,
 		0,
-		gl.RGBA,
+		t.format.internalFormat,
 		int32(t.width),
 		int32(t.height),
 		0,
-		gl.RGBA,
-		gl.UNSIGNED_BYTE,
-		gl.Ptr(data))
+		t.format.format,
+		t.format.dataType,
+		data)
 }
 
 func LoadTexturePNG(filePath string) (*Texture, error) {
-	ret := &Texture{}
-
 	imgFile, err := os.Open(filePath)
 	if err != nil {
 		return nil, errors.Wrap(err, "open texture file")
@@ -64,38 +133,21 @@ func LoadTexturePNG(filePath string) (*Texture, error) {
 		return nil, errors.New("unsupported stride")
 	}
 
-	ret.width = rgba.Rect.Size().X
-	ret.height = rgba.Rect.Size().Y
-
 	draw.Draw(rgba, rgba.Bounds(), img, image.Point{0, 0}, draw.Src)
 
-	gl.GenTextures(1, &ret.rendererId)
-	ret.Bind(0)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
-	gl.TexImage2D(
-		gl.TEXTURE_2D,
-		0,
-		gl.RGBA8,
-		int32(ret.width),
-		int32(ret.height),
-		0,
-		gl.RGBA,
-		gl.UNSIGNED_BYTE,
-		gl.Ptr(rgba.Pix))
+	ret := NewTexture(rgba.Rect.Size().X, rgba.Rect.Size().Y)
+	ret.SetImageData(rgba.Pix)
 
 	return ret, nil
 }
 
 func (t *Texture) Bind(slot uint32) {
 	gl.ActiveTexture(gl.TEXTURE0 + slot)
-	gl.BindTexture(gl.TEXTURE_2D, t.rendererId)
+	gl.BindTexture(t.target, t.rendererId)
 }
 
 func (t Texture) Unbind() {
-	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.BindTexture(t.target, 0)
 }
 
 func (t Texture) Destroy() {
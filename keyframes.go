@@ -0,0 +1,271 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"mandelbrot/coloring"
+	"mandelbrot/fractal"
+	"math"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+const (
+	DefaultKeyframeRatio = 2.0
+
+	// Width of the blended edge of the next keyframe relative to the distance from its edge to the frame edge
+	keyframeFeather = 0.5
+)
+
+// keyframeZoom synthesizes frames of a zoom into a fixed center from keyframes.
+// Keyframes are rendered at magnifications growing by the ratio. A keyframe shows the view
+// of the frame of its magnification at the ratio times larger resolution, so it is sharp
+// in all the frames until the next keyframe. A frame is the enlarged previous keyframe
+// with the next one blended over its center, where the next one shows more details
+type keyframeZoom struct {
+	generator fractal.Generator
+	colorizer *coloring.Colorizer
+	center    *State // Fixed center and magnification of the first frame
+
+	ratio      float64 // Magnification ratio between keyframes
+	oversample float64 // Extra resolution of keyframes
+	doublings  float64 // Binary logarithm of the whole zoom magnification
+	scaler     draw.Interpolator
+
+	width, height int
+	keyframes     map[int]*image.RGBA // Rendered keyframes that are still needed
+}
+
+func newKeyframeZoom(
+	generator fractal.Generator,
+	colorizer *coloring.Colorizer,
+	from, to *State,
+	ratio, oversample float64,
+	scaler draw.Interpolator,
+) *keyframeZoom {
+	// keyframes are colorized alike, so mappings like histogram don't show the next keyframe as a rectangle.
+	// The mapping is built by the first and the last frames together
+	first := generateField(nil, generator, from, colorizer.Options(), func(float32) {})
+	last := generateField(nil, generator, to, colorizer.Options(), func(float32) {})
+	colorizer.Calibrate(&fractal.Field{
+		Width:  first.Width,
+		Height: first.Height + last.Height,
+		Orbits: append(first.Orbits, last.Orbits...),
+	})
+
+	return &keyframeZoom{
+		generator:  generator,
+		colorizer:  colorizer,
+		center:     from,
+		ratio:      ratio,
+		oversample: oversample,
+		doublings:  log2Big(from.GetScale()) - log2Big(to.GetScale()),
+		scaler:     scaler,
+		width:      int(to.GetScreenWidth()),
+		height:     int(to.GetScreenHeight()),
+		keyframes:  map[int]*image.RGBA{},
+	}
+}
+
+// Keyframes returns number of keyframes needed for the whole zoom
+func (k *keyframeZoom) Keyframes() int {
+	return int(math.Ceil(k.doublings/math.Log2(k.ratio)-1e-9)) + 1
+}
+
+// Render keyframe or get it from the cache
+func (k *keyframeZoom) keyframe(index int) *image.RGBA {
+	if img, ok := k.keyframes[index]; ok {
+		return img
+	}
+
+	// keyframe is enlarged up to the ratio until the next keyframe, so it has the ratio times more pixels
+	size := k.ratio * k.oversample
+	scale := mulExp2Big(k.center.GetScale(), -float64(index)*math.Log2(k.ratio))
+	state, _ := NewStateScale(
+		k.center.GetCX(), k.center.GetCY(), scale,
+		int(math.Ceil(float64(k.width)*size)), int(math.Ceil(float64(k.height)*size)),
+	)
+
+	started := time.Now()
+	img := renderImage(nil, k.generator, k.colorizer, state, func(float32) {})
+	_, _ = fmt.Fprintf(os.Stderr, "keyframe %d/%d: %dx%d in %s\n",
+		index+1, k.Keyframes(), img.Rect.Dx(), img.Rect.Dy(), time.Since(started).Round(time.Millisecond))
+
+	k.keyframes[index] = img
+
+	return img
+}
+
+// Draw keyframe scaled by the zoom into the frame center, zoom 1 fills the whole frame
+func (k *keyframeZoom) drawKeyframe(dst *image.RGBA, src *image.RGBA, zoom float64) {
+	s := zoom * float64(k.width) / float64(src.Rect.Dx())
+	srcCX, srcCY := float64(src.Rect.Dx())/2, float64(src.Rect.Dy())/2
+	dstCX, dstCY := float64(k.width)/2, float64(k.height)/2
+
+	s2d := f64.Aff3{
+		s, 0, dstCX - srcCX*s,
+		0, s, dstCY - srcCY*s,
+	}
+
+	// pixels outside of the keyframe are kept
+	k.scaler.Transform(dst, s2d, src, src.Rect, draw.Src, nil)
+}
+
+// Blend keyframe scaled by the zoom over the frame center. Its edge fades out,
+// the faded edge narrows while the keyframe grows and vanishes when it fills the frame
+func (k *keyframeZoom) blendKeyframe(dst *image.RGBA, src *image.RGBA, zoom float64) {
+	inset := image.NewRGBA(dst.Rect)
+	k.drawKeyframe(inset, src, zoom)
+
+	// alpha along an axis of the frame of the given size: the distance to the keyframe edge relative to the faded edge
+	alpha := func(pos int, size int) float64 {
+		half := float64(size) / 2
+		insetHalf := zoom * half
+		distance := insetHalf - math.Abs(float64(pos)+0.5-half)
+		feather := keyframeFeather * (half - insetHalf)
+		if distance <= 0 {
+			return 0
+		} else if distance >= feather {
+			return 1
+		}
+		return distance / feather
+	}
+
+	for y := 0; y < k.height; y++ {
+		ay := alpha(y, k.height)
+		if ay == 0 {
+			continue
+		}
+
+		for x := 0; x < k.width; x++ {
+			a := ay * alpha(x, k.width)
+			if a == 0 {
+				continue
+			}
+
+			i := dst.PixOffset(x, y)
+			for c := i; c < i+4; c++ {
+				dst.Pix[c] = uint8(float64(dst.Pix[c]) + (float64(inset.Pix[c])-float64(dst.Pix[c]))*a + 0.5)
+			}
+		}
+	}
+}
+
+// Frame synthesizes the frame at the given number of magnification doublings from the first frame
+func (k *keyframeZoom) Frame(doublings float64) *image.RGBA {
+	position := doublings / math.Log2(k.ratio)
+	index := int(math.Floor(position))
+	if index >= k.Keyframes()-1 {
+		index = k.Keyframes() - 2
+	}
+	if index < 0 {
+		index = 0
+	}
+
+	// frames go forward, so previous keyframes are not needed anymore
+	for i := range k.keyframes {
+		if i < index {
+			delete(k.keyframes, i)
+		}
+	}
+
+	// zoom relative to the keyframe in range [1, ratio]
+	fraction := position - float64(index)
+	zoom := math.Pow(k.ratio, fraction)
+
+	dst := image.NewRGBA(image.Rect(0, 0, k.width, k.height))
+	k.drawKeyframe(dst, k.keyframe(index), zoom)
+
+	// the next keyframe covers the center of the frame with more details. It grows
+	// to the whole frame at the next keyframe, so frames switch to it without popping
+	if fraction > 0 {
+		k.blendKeyframe(dst, k.keyframe(index+1), zoom/k.ratio)
+	}
+
+	return dst
+}
+
+func parseScaler(name string) (draw.Interpolator, error) {
+	switch name {
+	case "nearest":
+		return draw.NearestNeighbor, nil
+	case "bilinear":
+		return draw.BiLinear, nil
+	case "catmullrom":
+		return draw.CatmullRom, nil
+	default:
+		return nil, fmt.Errorf("unknown scaling filter: %s", name)
+	}
+}
+
+// fastzoom subcommand: zoom animation into a fixed center synthesized from keyframes
+func fastZoomCommand(args []string) error {
+	fs := flag.NewFlagSet("fastzoom", flag.ExitOnError)
+	fromZoom := fs.String("from-zoom", "1", "magnification of the first frame")
+	framesPerDoubling := fs.Float64("fpd", DefaultFramesPerDoubling, "frames per doubling of magnification")
+	frames := fs.Int("frames", 0, "number of frames, 0 to calculate it from -fpd")
+	easingStr := fs.String("ease", "none", "zoom speed easing: none, in, out or inout")
+	ratio := fs.Float64("ratio", DefaultKeyframeRatio, "magnification ratio between keyframes")
+	oversample := fs.Float64("oversample", 1, "keyframes resolution multiplier, higher values give sharper frames")
+	scalerStr := fs.String("filter", "catmullrom", "keyframes scaling filter: nearest, bilinear or catmullrom")
+	frameOpts := newFrameOptions()
+	frameOpts.register(fs)
+	opts := newRenderOptions()
+	opts.register(fs)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: %s fastzoom [options]\n"+
+			"Zooms into -cx, -cy from -from-zoom to -zoom rendering keyframes only\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *ratio <= 1 || *oversample <= 0 {
+		return errors.New("ratio must be greater than 1 and oversample must be positive")
+	}
+
+	easing, err := parseEasing(*easingStr)
+	if err != nil {
+		return err
+	}
+
+	scaler, err := parseScaler(*scalerStr)
+	if err != nil {
+		return err
+	}
+
+	from, err := NewStateView(opts.CX, opts.CY, *fromZoom, opts.Width, opts.Height)
+	if err != nil {
+		return err
+	}
+
+	to, err := opts.State()
+	if err != nil {
+		return err
+	}
+
+	generator, colorizer, err := opts.build()
+	if err != nil {
+		return err
+	}
+
+	zoom := newKeyframeZoom(generator, colorizer, from, to, *ratio, *oversample, scaler)
+	if zoom.doublings <= 0 {
+		return errors.New("-zoom must be greater than -from-zoom")
+	}
+
+	if *frames <= 0 {
+		*frames = newZoomPath(from, to).Frames(*framesPerDoubling)
+	}
+	if *frames < 2 {
+		return errors.New("at least 2 frames expected")
+	}
+
+	return frameOpts.writeFrames(opts.Width, opts.Height, *frames, func(frame int) (*image.RGBA, error) {
+		return zoom.Frame(zoom.doublings * easing(float64(frame)/float64(*frames-1))), nil
+	})
+}
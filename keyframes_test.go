@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// Mean absolute difference of color components of the images
+func meanDifference(a, b *image.RGBA) float64 {
+	sum := 0.0
+	for i := range a.Pix {
+		sum += math.Abs(float64(a.Pix[i]) - float64(b.Pix[i]))
+	}
+
+	return sum / float64(len(a.Pix))
+}
+
+func TestKeyframeZoomFrames(t *testing.T) {
+	// histogram mapping depends on all the values of an image, keyframes must be colorized alike anyway
+	for _, mapping := range []string{"linear", "histogram"} {
+		opts := newRenderOptions()
+		opts.CX, opts.CY = "-0.7453", "0.1127"
+		opts.Width, opts.Height = 96, 64
+		opts.Iterations = 300
+		opts.Mapping = mapping
+
+		generator, colorizer, err := opts.build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		from, err := NewStateView(opts.CX, opts.CY, "20", opts.Width, opts.Height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		to, err := NewStateView(opts.CX, opts.CY, "320", opts.Width, opts.Height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		zoom := newKeyframeZoom(generator, colorizer, from, to, 2, 2, draw.CatmullRom)
+
+		// direct renders are done at the keyframes resolution and scaled down to the frame size,
+		// so frames at keyframes are the same and frames between them differ only by scaling
+		size := 4
+		for _, doublings := range []float64{0, 0.25, 0.5, 0.75, 1, 2.5, 4} {
+			state, err := NewStateScale(from.GetCX(), from.GetCY(), mulExp2Big(from.GetScale(), -doublings),
+				opts.Width*size, opts.Height*size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			large := renderImage(nil, generator, colorizer, state, func(float32) {})
+			direct := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+			draw.CatmullRom.Scale(direct, direct.Rect, large, large.Rect, draw.Src, nil)
+
+			limit := 2.5
+			if doublings == math.Floor(doublings) {
+				limit = 0.5
+			}
+			if diff := meanDifference(zoom.Frame(doublings), direct); diff > limit {
+				t.Errorf("%s mapping: frame at %g doublings differs from the direct render by %.2f", mapping, doublings, diff)
+			}
+		}
+	}
+}
@@ -3,8 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
-	"mandelbrot/fractal/mandelbrot"
+	"mandelbrot/palette"
 	"math/big"
+	"os"
 )
 
 func MustParseBigFloat(s string, precision uint) *big.Float {
@@ -15,39 +16,161 @@ func MustParseBigFloat(s string, precision uint) *big.Float {
 	return z
 }
 
+// Subcommands run without a window, the viewer is started if none is given
+var commands = map[string]func(args []string) error{
+	"render":     renderCommand,
+	"batch":      batchCommand,
+	"zoom":       zoomCommand,
+	"fastzoom":   fastZoomCommand,
+	"gif":        gifCommand,
+	"animate":    animateCommand,
+	"poster":     posterCommand,
+	"tiles":      tilesCommand,
+	"serve":      serveCommand,
+	"worker":     workerCommand,
+	"distribute": distributeCommand,
+	"convert":    convertCommand,
+	"extract":    extractCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	app := NewApplication("Mandelbrot Fractal Explorer")
 
 	generatorStr := flag.String("generator", "float64", "select generator: big or float64")
+	iterations := flag.Int("iterations", 0, "iterations limit, 0 for default")
+	listPalettes := flag.Bool("list-palettes", false, "list built-in palettes and exit")
+	drawPalette := flag.Bool("draw-palette", false, "write selected palette as PNG strip to stdout and exit")
+	savePalette := flag.String("save-palette", "", "save selected palette to file and exit, format is selected by extension")
+	gpu := flag.Bool("gpu", false, "map palette in the fragment shader, toggle with G key")
+	gpuDensity := flag.Float64("gpu-density", DefaultGPUDensity, "palette repeats when colorizing on GPU, in addition to -gradient-repeats")
+	cycleSpeed := flag.Float64("cycle-speed", DefaultCycleSpeed, "palette cycling speed in cycles per second, toggle cycling with C key")
+	colors := newColorOptions()
+	colors.register(flag.CommandLine)
+	cache := newCacheOptions(DefaultFieldCacheSize)
+	cache.register(flag.CommandLine)
+	bookmarksPath, _ := DefaultBookmarksPath()
+	flag.StringVar(&bookmarksPath, "bookmarks", bookmarksPath, "bookmarks file, B key saves current view, N and Shift+N cycle bookmarks")
+	bookmarkName := flag.String("bookmark", "", "start at the bookmark of the name")
+	listBookmarks := flag.Bool("list-bookmarks", false, "list built-in and saved bookmarks and exit")
+	importPath := flag.String("import", "", "start at location of a Kalles Fraktaler .kfr, Fractint .par or XaoS .xpf file")
+	entry := flag.String("entry", "", "entry of the imported Fractint parameter file, the first Mandelbrot entry if empty")
+	exportPath := flag.String("export", "", "location file written by E key, format is selected by the extension: .kfr, .par or .xpf")
 	flag.Parse()
 
-	if generatorStr == nil {
-		panic("generator")
-	}
-
-	if *generatorStr == "big" {
-		app.SetGenerator(mandelbrot.NewBigDefault())
-	} else if *generatorStr == "float64" {
-		app.SetGenerator(mandelbrot.NewFloat64Default())
-	} else {
-		panic(*generatorStr)
-	}
-
-	fmt.Printf("Using %s generator\n", *generatorStr)
-
-	//cx := "-1.48656573768883788853042260418005804552266102547264"
-	//cy := "0.03579713550865033095370105522259793185378684565734"
-	//scale := "0.00000000000000640180414098903887916742577864421037"
-	//physWidth := "0.00000000000001920541242296711114025336924125917013"
-	//physHeight := "0.00000000000001280360828197809092253489087575796220"
-	//
-	//precision := application.state.GetPrecision()
-	//
-	//application.state.GetCX().Set(MustParseBigFloat(cx, precision))
-	//application.state.GetCY().Set(MustParseBigFloat(cy, precision))
-	//application.state.GetScale().Set(MustParseBigFloat(scale, precision))
-	//application.state.GetPhysicalWidth().Set(MustParseBigFloat(physWidth, precision))
-	//application.state.GetPhysicalHeight().Set(MustParseBigFloat(physHeight, precision))
+	if *listPalettes {
+		for _, b := range palette.ListBuiltins() {
+			fmt.Printf("%-16s %s\n", b.Name, b.Description)
+			if b.GetCosine() != nil {
+				fmt.Printf("%-16s -cosine %s\n", "", b.GetCosine())
+			}
+		}
+		return
+	}
+
+	bookmarks, err := NewBookmarkStore(bookmarksPath)
+	if err != nil {
+		panic(err)
+	}
+
+	if *listBookmarks {
+		for _, b := range bookmarks.GetBookmarks() {
+			fmt.Printf("%-24s cx=%s cy=%s scale=%s\n", b.Name, b.CX, b.CY, b.Scale)
+		}
+		return
+	}
+
+	iterationsLimit := *iterations
+	if *importPath != "" {
+		state, fileIterations, err := importState(*importPath, *entry, int(DefaultScreenWidth), int(DefaultScreenHeight))
+		if err != nil {
+			panic(err)
+		}
+		app.SetState(state)
+
+		if iterationsLimit == 0 {
+			iterationsLimit = fileIterations
+		}
+	}
+
+	if err := app.UseGenerator(*generatorStr, iterationsLimit); err != nil {
+		panic(err)
+	}
+	app.SetBookmarks(bookmarks)
+	app.SetExportPath(*exportPath)
+
+	if *bookmarkName != "" {
+		b, ok := bookmarks.Find(*bookmarkName)
+		if !ok {
+			panic(fmt.Sprintf("unknown bookmark: %s", *bookmarkName))
+		}
+		if err := app.GoToBookmark(b); err != nil {
+			panic(err)
+		}
+	}
+
+	gradient, err := colors.BuildGradient()
+	if err != nil {
+		panic(err)
+	}
+
+	mode, err := colors.Mode()
+	if err != nil {
+		panic(err)
+	}
+
+	pal, err := colors.BuildPalette(gradient)
+	if err != nil {
+		panic(err)
+	}
+
+	if *drawPalette {
+		palette.DrawPalette(pal)
+		return
+	}
+
+	if *savePalette != "" {
+		if gradient == nil {
+			panic("-save-palette requires -palette, -cosine, -extract-palette or -gradient")
+		}
+		if err := palette.Save(*savePalette, gradient); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	colorizer, err := colors.BuildColorizer(pal)
+	if err != nil {
+		panic(err)
+	}
+
+	fieldCache, err := cache.open()
+	if err != nil {
+		panic(err)
+	}
+
+	app.SetColorizer(colorizer)
+	app.SetFieldCache(fieldCache)
+	app.SetCycleSpeed(*cycleSpeed)
+	// the shader repeats and mirrors the palette, so it gets a single period of the gradient
+	gpuPalette := pal
+	if gradient != nil {
+		gradient.SetMode(palette.ModeClamp)
+		gradient.SetRepeats(1)
+		gpuPalette = gradient.Palette(colors.PaletteSize)
+	}
+	app.SetGPUColorizing(*gpu, float32(*gpuDensity*colors.GradientRepeats), mode, gpuPalette)
+
+	fmt.Printf("Using %s generator with %s coloring\n", *generatorStr, colors.Coloring)
 
 	app.Run()
 }
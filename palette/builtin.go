@@ -0,0 +1,146 @@
+package palette
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Builtin is a named palette shipped with the program
+type Builtin struct {
+	Name        string
+	Description string
+
+	stops  string  // Gradient stops in the form accepted by ParseStops
+	space  Space   // Interpolation color space of stops
+	cosine *Cosine // Cosine palette coefficients, used instead of stops when set
+}
+
+// GetCosine returns coefficients of a cosine palette or nil for gradient palettes
+func (b *Builtin) GetCosine() *Cosine {
+	return b.cosine
+}
+
+// Gradient creates a new gradient of the palette
+func (b *Builtin) Gradient() *Gradient {
+	if b.cosine != nil {
+		return b.cosine.Gradient()
+	}
+
+	stops, err := ParseStops(b.stops)
+	if err != nil {
+		panic(err)
+	}
+
+	ret := NewGradient(b.space, ModeClamp)
+	for _, stop := range stops {
+		ret.AddStop(stop.Position, stop.Color)
+	}
+
+	return ret
+}
+
+// Perceptually uniform maps are sampled from matplotlib colormaps at 9 evenly spaced points
+var builtins = []*Builtin{
+	{
+		Name:        "viridis",
+		Description: "perceptually uniform, colorblind-safe blue-green-yellow",
+		stops:       "0:#440154,0.125:#472d7b,0.25:#3b528b,0.375:#2c728e,0.5:#21908c,0.625:#27ad81,0.75:#5dc863,0.875:#aadc32,1:#fde725",
+		space:       SpaceRGB,
+	},
+	{
+		Name:        "cividis",
+		Description: "perceptually uniform, optimized for color vision deficiency blue-yellow",
+		stops:       "0:#00204d,0.125:#00336f,0.25:#39486b,0.375:#575c6d,0.5:#707173,0.625:#8a8779,0.75:#a69d75,0.875:#c4b56c,1:#fee838",
+		space:       SpaceRGB,
+	},
+	{
+		Name:        "magma",
+		Description: "perceptually uniform, colorblind-safe black-purple-cream",
+		stops:       "0:#000004,0.125:#1d1147,0.25:#51127c,0.375:#822681,0.5:#b63679,0.625:#e65164,0.75:#fb8861,0.875:#fec287,1:#fcfdbf",
+		space:       SpaceRGB,
+	},
+	{
+		Name:        "inferno",
+		Description: "perceptually uniform, colorblind-safe black-red-yellow",
+		stops:       "0:#000004,0.125:#1b0c42,0.25:#4b0c6b,0.375:#781c6d,0.5:#a52c60,0.625:#cf4446,0.75:#ed6925,0.875:#fb9a06,1:#fcffa4",
+		space:       SpaceRGB,
+	},
+	{
+		Name:        "plasma",
+		Description: "perceptually uniform, colorblind-safe blue-magenta-yellow",
+		stops:       "0:#0d0887,0.125:#47039f,0.25:#7301a8,0.375:#9c179e,0.5:#bd3786,0.625:#d8576b,0.75:#ed7953,0.875:#fa9e3b,1:#f0f921",
+		space:       SpaceRGB,
+	},
+	{
+		Name:        "grayscale",
+		Description: "black to white",
+		stops:       "0:#000000,1:#ffffff",
+		space:       SpaceRGB,
+	},
+	{
+		Name:        "classic",
+		Description: "classic deep blue, white and gold fractal palette",
+		stops:       "0:#000764,0.16:#206bcb,0.42:#edffff,0.6425:#ffaa00,0.8575:#000200,1:#000764",
+		space:       SpaceOKLab,
+	},
+	{
+		Name:        "fire",
+		Description: "black, red, orange, yellow and white",
+		stops:       "0:#000000,0.3:#8b0000,0.55:#ff4500,0.8:#ffd700,1:#ffffff",
+		space:       SpaceOKLab,
+	},
+	{
+		Name:        "ice",
+		Description: "black, navy, cyan and white",
+		stops:       "0:#000000,0.35:#0b1f6b,0.7:#38c6f4,1:#ffffff",
+		space:       SpaceOKLab,
+	},
+	{
+		Name:        "psychedelic",
+		Description: "saturated rainbow cycle",
+		stops:       "0:#ff0000,0.17:#ffff00,0.33:#00ff00,0.5:#00ffff,0.67:#0000ff,0.83:#ff00ff,1:#ff0000",
+		space:       SpaceRGB,
+	},
+	{
+		Name:        "cosine-rainbow",
+		Description: "cosine palette, rainbow",
+		cosine:      &Cosine{A: [3]float64{0.5, 0.5, 0.5}, B: [3]float64{0.5, 0.5, 0.5}, C: [3]float64{1, 1, 1}, D: [3]float64{0, 0.33, 0.67}},
+	},
+	{
+		Name:        "cosine-sunset",
+		Description: "cosine palette, warm red, orange and blue",
+		cosine:      &Cosine{A: [3]float64{0.5, 0.5, 0.5}, B: [3]float64{0.5, 0.5, 0.5}, C: [3]float64{1, 1, 1}, D: [3]float64{0, 0.1, 0.2}},
+	},
+	{
+		Name:        "cosine-earth",
+		Description: "cosine palette, earthy browns, greens and blues",
+		cosine:      &Cosine{A: [3]float64{0.5, 0.5, 0.5}, B: [3]float64{0.5, 0.5, 0.5}, C: [3]float64{1, 0.7, 0.4}, D: [3]float64{0, 0.15, 0.2}},
+	},
+	{
+		Name:        "cosine-neon",
+		Description: "cosine palette, bright pink, orange and teal",
+		cosine:      &Cosine{A: [3]float64{0.8, 0.5, 0.4}, B: [3]float64{0.2, 0.4, 0.2}, C: [3]float64{2, 1, 1}, D: [3]float64{0, 0.25, 0.25}},
+	},
+}
+
+// GetBuiltin returns built-in palette by name
+func GetBuiltin(name string) (*Builtin, error) {
+	for _, b := range builtins {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown palette: %s", name)
+}
+
+// ListBuiltins returns all built-in palettes ordered by name
+func ListBuiltins() []*Builtin {
+	ret := make([]*Builtin, len(builtins))
+	copy(ret, builtins)
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+
+	return ret
+}
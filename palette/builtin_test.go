@@ -0,0 +1,41 @@
+package palette
+
+import (
+	"testing"
+)
+
+func TestBuiltins(t *testing.T) {
+	for _, b := range ListBuiltins() {
+		if len(b.Gradient().GetStops()) < 2 {
+			t.Errorf("%s: at least 2 stops expected", b.Name)
+		}
+
+		if _, err := GetBuiltin(b.Name); err != nil {
+			t.Errorf("%s: %v", b.Name, err)
+		}
+	}
+
+	if _, err := GetBuiltin("unknown"); err == nil {
+		t.Error("error expected for unknown palette")
+	}
+}
+
+func TestParseCosine(t *testing.T) {
+	cosine, err := ParseCosine("0.5,0.5,0.5:0.5,0.5,0.5:1,1,1:0,0.33,0.67")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseCosine(cosine.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *parsed != *cosine {
+		t.Errorf("%+v parsed back as %+v", cosine, parsed)
+	}
+
+	if _, err := ParseCosine("0.5,0.5:1,1,1"); err == nil {
+		t.Error("error expected for invalid coefficients")
+	}
+}
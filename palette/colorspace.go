@@ -0,0 +1,145 @@
+package palette
+
+import (
+	"image/color"
+	"math"
+)
+
+// Space is a color space used for interpolation between gradient stops
+type Space int
+
+const (
+	SpaceRGB   Space = iota // Plain sRGB components
+	SpaceOKLab              // Perceptual OKLab space
+	SpaceLab                // CIELAB space with D65 white point
+)
+
+// D65 reference white
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+// Convert color into components of the given space
+func toSpace(c color.RGBA, space Space) [3]float64 {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+
+	switch space {
+	case SpaceOKLab:
+		return linearToOKLab(srgbToLinear(r), srgbToLinear(g), srgbToLinear(b))
+	case SpaceLab:
+		return linearToLab(srgbToLinear(r), srgbToLinear(g), srgbToLinear(b))
+	default:
+		return [3]float64{r, g, b}
+	}
+}
+
+// Convert components of the given space back into color
+func fromSpace(v [3]float64, alpha uint8, space Space) color.RGBA {
+	var r, g, b float64
+
+	switch space {
+	case SpaceOKLab:
+		r, g, b = okLabToLinear(v)
+		r, g, b = linearToSRGB(r), linearToSRGB(g), linearToSRGB(b)
+	case SpaceLab:
+		r, g, b = labToLinear(v)
+		r, g, b = linearToSRGB(r), linearToSRGB(g), linearToSRGB(b)
+	default:
+		r, g, b = v[0], v[1], v[2]
+	}
+
+	return color.RGBA{
+		R: toUint8(r),
+		G: toUint8(g),
+		B: toUint8(b),
+		A: alpha,
+	}
+}
+
+func toUint8(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(1, v))*255 + 0.5)
+}
+
+func srgbToLinear(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(c float64) float64 {
+	if c <= 0.0031308 {
+		return c * 12.92
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
+
+func linearToOKLab(r, g, b float64) [3]float64 {
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+
+	return [3]float64{
+		0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+func okLabToLinear(v [3]float64) (float64, float64, float64) {
+	l := v[0] + 0.3963377774*v[1] + 0.2158037573*v[2]
+	m := v[0] - 0.1055613458*v[1] - 0.0638541728*v[2]
+	s := v[0] - 0.0894841775*v[1] - 1.2914855480*v[2]
+
+	l, m, s = l*l*l, m*m*m, s*s*s
+
+	return 4.0767416621*l - 3.3077115913*m + 0.2309699292*s,
+		-1.2684380046*l + 2.6097574011*m - 0.3413193965*s,
+		-0.0041960863*l - 0.7034186147*m + 1.7076147010*s
+}
+
+func linearToLab(r, g, b float64) [3]float64 {
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / whiteX
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / whiteY
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / whiteZ
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+
+	return [3]float64{
+		116*fy - 16,
+		500 * (fx - fy),
+		200 * (fy - fz),
+	}
+}
+
+func labToLinear(v [3]float64) (float64, float64, float64) {
+	fy := (v[0] + 16) / 116
+	fx := fy + v[1]/500
+	fz := fy - v[2]/200
+
+	x := labFInverse(fx) * whiteX
+	y := labFInverse(fy) * whiteY
+	z := labFInverse(fz) * whiteZ
+
+	return 3.2404542*x - 1.5371385*y - 0.4985314*z,
+		-0.9692660*x + 1.8760108*y + 0.0415560*z,
+		0.0556434*x - 0.2040259*y + 1.0572252*z
+}
+
+const labDelta = 6.0 / 29
+
+func labF(t float64) float64 {
+	if t > labDelta*labDelta*labDelta {
+		return math.Cbrt(t)
+	}
+	return t/(3*labDelta*labDelta) + 4.0/29
+}
+
+func labFInverse(t float64) float64 {
+	if t > labDelta {
+		return t * t * t
+	}
+	return 3 * labDelta * labDelta * (t - 4.0/29)
+}
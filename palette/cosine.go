@@ -0,0 +1,80 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Number of stops used to approximate a cosine palette with a gradient
+const cosineStops = 64
+
+// Cosine is a palette defined by formula a + b * cos(2π * (c*t + d)),
+// calculated for every color component
+type Cosine struct {
+	A, B, C, D [3]float64
+}
+
+// At returns palette color at position t
+func (p *Cosine) At(t float64) color.RGBA {
+	var v [3]float64
+	for i := range v {
+		v[i] = p.A[i] + p.B[i]*math.Cos(2*math.Pi*(p.C[i]*t+p.D[i]))
+	}
+
+	return floatColor(v[0], v[1], v[2], 1)
+}
+
+// Gradient approximates the cosine palette with a gradient
+func (p *Cosine) Gradient() *Gradient {
+	ret := NewGradient(SpaceRGB, ModeClamp)
+	for i := 0; i <= cosineStops; i++ {
+		t := float64(i) / cosineStops
+		ret.AddStop(t, p.At(t))
+	}
+
+	return ret
+}
+
+// String returns coefficients in the form accepted by ParseCosine
+func (p *Cosine) String() string {
+	parts := make([]string, 0, 4)
+	for _, v := range [][3]float64{p.A, p.B, p.C, p.D} {
+		parts = append(parts, fmt.Sprintf("%g,%g,%g", v[0], v[1], v[2]))
+	}
+
+	return strings.Join(parts, ":")
+}
+
+// ParseCosine parses cosine palette coefficients in the form "ar,ag,ab:br,bg,bb:cr,cg,cb:dr,dg,db"
+func ParseCosine(s string) (*Cosine, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid cosine palette %q: 4 coefficients a:b:c:d expected", s)
+	}
+
+	var coefficients [4][3]float64
+	for i, part := range parts {
+		values := strings.Split(part, ",")
+		if len(values) != 3 {
+			return nil, fmt.Errorf("invalid cosine palette %q: coefficient must have 3 components", s)
+		}
+
+		for j, value := range values {
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cosine palette %q: %v", s, err)
+			}
+			coefficients[i][j] = v
+		}
+	}
+
+	return &Cosine{
+		A: coefficients[0],
+		B: coefficients[1],
+		C: coefficients[2],
+		D: coefficients[3],
+	}, nil
+}
@@ -0,0 +1,344 @@
+package palette
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Quantizer is an algorithm reducing image colors to a few representative ones
+type Quantizer int
+
+const (
+	QuantizerKMeans    Quantizer = iota // Lloyd's k-means with k-means++ seeding
+	QuantizerMedianCut                  // Recursive split of the most spread color box
+)
+
+const (
+	// Images are subsampled to about this many pixels before quantization
+	extractSamples = 65536
+
+	kMeansIterations = 32
+)
+
+func ParseQuantizer(s string) (Quantizer, error) {
+	switch s {
+	case "kmeans":
+		return QuantizerKMeans, nil
+	case "median-cut":
+		return QuantizerMedianCut, nil
+	default:
+		return 0, fmt.Errorf("unknown quantizer: %s", s)
+	}
+}
+
+// ExtractFile reads PNG or JPEG image and extracts a gradient from its colors, see Extract
+func ExtractFile(path string, count int, quantizer Quantizer) (*Gradient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open image file")
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode image")
+	}
+
+	return Extract(img, count, quantizer)
+}
+
+// Extract reduces image colors to count representative ones in OKLab space
+// and orders them into a smooth path, so the gradient has no abrupt jumps
+func Extract(img image.Image, count int, quantizer Quantizer) (*Gradient, error) {
+	if count < 2 {
+		return nil, errors.New("at least 2 colors expected")
+	}
+
+	centers, err := quantize([]image.Image{img}, count, quantizer)
+	if err != nil {
+		return nil, err
+	}
+
+	colors := make([]color.RGBA, 0, len(centers))
+	for _, c := range smoothPath(centers) {
+		colors = append(colors, fromSpace(c, 255, SpaceOKLab))
+	}
+
+	ret := evenGradient(colors)
+	ret.SetSpace(SpaceOKLab)
+
+	return ret, nil
+}
+
+// Quantize reduces colors of all the images to at most count representative ones
+func Quantize(images []image.Image, count int, quantizer Quantizer) (color.Palette, error) {
+	centers, err := quantize(images, count, quantizer)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(color.Palette, len(centers))
+	for i, c := range centers {
+		ret[i] = fromSpace(c, 255, SpaceOKLab)
+	}
+
+	return ret, nil
+}
+
+func quantize(images []image.Image, count int, quantizer Quantizer) ([][3]float64, error) {
+	samples := samplePixels(images)
+	if len(samples) == 0 {
+		return nil, errors.New("no opaque pixels in image")
+	}
+
+	if quantizer == QuantizerMedianCut {
+		return medianCut(samples, count), nil
+	}
+
+	return kMeans(samples, count), nil
+}
+
+// Convert pixels into OKLab, large images are subsampled with a regular step
+func samplePixels(images []image.Image) [][3]float64 {
+	pixels := 0
+	for _, img := range images {
+		pixels += img.Bounds().Dx() * img.Bounds().Dy()
+	}
+
+	step := int(math.Sqrt(float64(pixels) / extractSamples))
+	if step < 1 {
+		step = 1
+	}
+
+	var ret [][3]float64
+	for _, img := range images {
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+			for x := bounds.Min.X; x < bounds.Max.X; x += step {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				if c.A < 128 {
+					continue
+				}
+				ret = append(ret, toSpace(color.RGBA{R: c.R, G: c.G, B: c.B, A: 255}, SpaceOKLab))
+			}
+		}
+	}
+
+	return ret
+}
+
+func distanceSquared(a, b [3]float64) float64 {
+	d0, d1, d2 := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return d0*d0 + d1*d1 + d2*d2
+}
+
+func nearest(p [3]float64, centers [][3]float64) (int, float64) {
+	best, bestDist := 0, math.Inf(1)
+	for i, c := range centers {
+		if d := distanceSquared(p, c); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+
+	return best, bestDist
+}
+
+func kMeans(samples [][3]float64, count int) [][3]float64 {
+	// fixed seed keeps extraction reproducible
+	rnd := rand.New(rand.NewSource(1))
+
+	// k-means++ seeding: next center is picked with probability proportional to squared distance
+	centers := [][3]float64{samples[rnd.Intn(len(samples))]}
+	dists := make([]float64, len(samples))
+	for i := range dists {
+		dists[i] = math.Inf(1)
+	}
+	for len(centers) < count {
+		// only the last added center may be closer than the previous ones
+		total := 0.0
+		last := centers[len(centers)-1]
+		for i, s := range samples {
+			dists[i] = math.Min(dists[i], distanceSquared(s, last))
+			total += dists[i]
+		}
+		if total == 0 {
+			// fewer distinct colors than requested
+			break
+		}
+
+		r := rnd.Float64() * total
+		picked := len(samples) - 1
+		for i, d := range dists {
+			r -= d
+			if r <= 0 {
+				picked = i
+				break
+			}
+		}
+		centers = append(centers, samples[picked])
+	}
+
+	assignment := make([]int, len(samples))
+	for iteration := 0; iteration < kMeansIterations; iteration++ {
+		changed := false
+		for i, s := range samples {
+			n, _ := nearest(s, centers)
+			if n != assignment[i] || iteration == 0 {
+				assignment[i] = n
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		sums := make([][3]float64, len(centers))
+		counts := make([]int, len(centers))
+		for i, s := range samples {
+			a := assignment[i]
+			sums[a][0] += s[0]
+			sums[a][1] += s[1]
+			sums[a][2] += s[2]
+			counts[a]++
+		}
+		for i := range centers {
+			if counts[i] > 0 {
+				n := float64(counts[i])
+				centers[i] = [3]float64{sums[i][0] / n, sums[i][1] / n, sums[i][2] / n}
+			}
+		}
+	}
+
+	return centers
+}
+
+type colorBox struct {
+	points [][3]float64
+	axis   int     // Component with the largest range
+	spread float64 // Range of the axis component
+}
+
+func newColorBox(points [][3]float64) *colorBox {
+	ret := &colorBox{points: points}
+	for axis := 0; axis < 3; axis++ {
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, p := range points {
+			min = math.Min(min, p[axis])
+			max = math.Max(max, p[axis])
+		}
+		if max-min > ret.spread {
+			ret.axis, ret.spread = axis, max-min
+		}
+	}
+
+	return ret
+}
+
+func medianCut(samples [][3]float64, count int) [][3]float64 {
+	boxes := []*colorBox{newColorBox(samples)}
+	for len(boxes) < count {
+		// split the box with the largest spread weighted by the number of points
+		split, splitScore := -1, 0.0
+		for i, b := range boxes {
+			score := b.spread * float64(len(b.points))
+			if len(b.points) > 1 && score > splitScore {
+				split, splitScore = i, score
+			}
+		}
+		if split < 0 {
+			break
+		}
+
+		b := boxes[split]
+		sort.Slice(b.points, func(i, j int) bool {
+			return b.points[i][b.axis] < b.points[j][b.axis]
+		})
+		// split at the mean rather than at the median, so clusters of similar colors are not cut in half
+		mean := 0.0
+		for _, p := range b.points {
+			mean += p[b.axis]
+		}
+		mean /= float64(len(b.points))
+		mid := sort.Search(len(b.points), func(i int) bool {
+			return b.points[i][b.axis] > mean
+		})
+		if mid == 0 || mid == len(b.points) {
+			mid = len(b.points) / 2
+		}
+		boxes[split] = newColorBox(b.points[:mid])
+		boxes = append(boxes, newColorBox(b.points[mid:]))
+	}
+
+	ret := make([][3]float64, len(boxes))
+	for i, b := range boxes {
+		for _, p := range b.points {
+			ret[i][0] += p[0]
+			ret[i][1] += p[1]
+			ret[i][2] += p[2]
+		}
+		n := float64(len(b.points))
+		ret[i] = [3]float64{ret[i][0] / n, ret[i][1] / n, ret[i][2] / n}
+	}
+
+	return ret
+}
+
+// Distance between colors of the path, zero if any of them is out of the path
+func edgeLength(path [][3]float64, a, b int) float64 {
+	if a < 0 || b >= len(path) {
+		return 0
+	}
+
+	return math.Sqrt(distanceSquared(path[a], path[b]))
+}
+
+// Limit of 2-opt passes over the path, every pass is quadratic in the number of colors
+const maxSmoothPasses = 16
+
+// Order colors into a short open path starting from the darkest one:
+// nearest neighbour path improved by reversing segments (2-opt)
+func smoothPath(colors [][3]float64) [][3]float64 {
+	rest := append([][3]float64(nil), colors...)
+	sort.Slice(rest, func(i, j int) bool {
+		return rest[i][0] < rest[j][0]
+	})
+
+	path := [][3]float64{rest[0]}
+	rest = rest[1:]
+	for len(rest) > 0 {
+		n, _ := nearest(path[len(path)-1], rest)
+		path = append(path, rest[n])
+		rest = append(rest[:n], rest[n+1:]...)
+	}
+
+	// reversing a segment only changes the edges at its ends
+	for pass, improved := 0, true; improved && pass < maxSmoothPasses; pass++ {
+		improved = false
+		for i := 1; i < len(path)-1; i++ {
+			for j := i + 1; j < len(path); j++ {
+				before := edgeLength(path, i-1, i) + edgeLength(path, j, j+1)
+				path[i], path[j] = path[j], path[i]
+				after := edgeLength(path, i-1, i) + edgeLength(path, j, j+1)
+				path[i], path[j] = path[j], path[i]
+
+				if after < before-1e-9 {
+					for a, b := i, j; a < b; a, b = a+1, b-1 {
+						path[a], path[b] = path[b], path[a]
+					}
+					improved = true
+				}
+			}
+		}
+	}
+
+	return path
+}
@@ -0,0 +1,44 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	colors := []color.RGBA{
+		{R: 255, G: 255, B: 255, A: 255},
+		{R: 0, G: 0, B: 0, A: 255},
+		{R: 128, G: 128, B: 128, A: 255},
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 30, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 30; x++ {
+			img.SetRGBA(x, y, colors[x/10])
+		}
+	}
+
+	for _, quantizer := range []Quantizer{QuantizerKMeans, QuantizerMedianCut} {
+		g, err := Extract(img, 3, quantizer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// colors are ordered from the darkest one along the shortest path
+		stops := g.GetStops()
+		if len(stops) != 3 {
+			t.Fatalf("quantizer %d: 3 stops expected, got %d", quantizer, len(stops))
+		}
+		for i, expected := range []uint8{0, 128, 255} {
+			if diff(stops[i].Color.R, expected) > 1 {
+				t.Errorf("quantizer %d: stop %d is %+v, expected gray %d", quantizer, i, stops[i].Color, expected)
+			}
+		}
+	}
+
+	if _, err := Extract(img, 1, QuantizerKMeans); err == nil {
+		t.Error("error expected for less than 2 colors")
+	}
+}
@@ -0,0 +1,147 @@
+package palette
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseError reports a problem at the given line of a palette file
+type ParseError struct {
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+func parseErrorf(line int, format string, args ...interface{}) error {
+	return &ParseError{Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// Format is a palette file format
+type Format interface {
+	// Read parses a gradient from the reader
+	Read(r io.Reader) (*Gradient, error)
+
+	// Write saves a gradient to the writer
+	Write(w io.Writer, g *Gradient) error
+}
+
+// Formats maps file extensions to palette file formats
+var Formats = map[string]Format{
+	".map":  &MapFormat{},
+	".ggr":  &GGRFormat{},
+	".ugr":  &UGRFormat{},
+	".csv":  &CSVFormat{},
+	".json": &JSONFormat{},
+}
+
+// FormatByPath returns palette file format by the file extension
+func FormatByPath(path string) (Format, error) {
+	format, ok := Formats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("unknown palette file format: %s", path)
+	}
+
+	return format, nil
+}
+
+// Load reads a gradient from file, format is selected by the file extension
+func Load(path string) (*Gradient, error) {
+	format, err := FormatByPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open palette file")
+	}
+	defer f.Close()
+
+	ret, err := format.Read(f)
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+
+	return ret, nil
+}
+
+// Save writes a gradient to file, format is selected by the file extension
+func Save(path string, g *Gradient) error {
+	format, err := FormatByPath(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "create palette file")
+	}
+
+	err = format.Write(f, g)
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, path)
+	}
+
+	return f.Close()
+}
+
+// lineScanner reads a file line by line keeping track of the line number
+type lineScanner struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newLineScanner(r io.Reader) *lineScanner {
+	return &lineScanner{scanner: bufio.NewScanner(r)}
+}
+
+func (s *lineScanner) Scan() bool {
+	ok := s.scanner.Scan()
+	if ok {
+		s.line++
+	}
+	return ok
+}
+
+func (s *lineScanner) Text() string {
+	return strings.TrimSpace(s.scanner.Text())
+}
+
+func (s *lineScanner) Err() error {
+	return s.scanner.Err()
+}
+
+// Create a gradient from colors spread evenly over range [0, 1]
+func evenGradient(colors []color.RGBA) *Gradient {
+	ret := NewGradient(SpaceRGB, ModeClamp)
+	for i, c := range colors {
+		position := 0.0
+		if len(colors) > 1 {
+			position = float64(i) / float64(len(colors)-1)
+		}
+		ret.AddStop(position, c)
+	}
+
+	return ret
+}
+
+// Sample gradient into the given number of colors spread evenly over range [0, 1]
+func evenColors(g *Gradient, count int) []color.RGBA {
+	ret := make([]color.RGBA, count)
+	for i := range ret {
+		ret[i] = g.At(float64(i) / float64(count-1))
+	}
+
+	return ret
+}
@@ -0,0 +1,149 @@
+package palette
+
+import (
+	"bytes"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+func testGradient() *Gradient {
+	ret := NewGradient(SpaceRGB, ModeClamp)
+	ret.AddStop(0, color.RGBA{R: 0, G: 7, B: 100, A: 255})
+	ret.AddStop(0.5, color.RGBA{R: 237, G: 255, B: 255, A: 255})
+	ret.AddStop(0.75, color.RGBA{R: 32, G: 107, B: 203, A: 255})
+	ret.AddStop(1, color.RGBA{R: 255, G: 170, B: 0, A: 255})
+	return ret
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+	g := testGradient()
+
+	for ext, format := range Formats {
+		var buf bytes.Buffer
+		if err := format.Write(&buf, g); err != nil {
+			t.Fatalf("%s: write: %v", ext, err)
+		}
+
+		loaded, err := format.Read(&buf)
+		if err != nil {
+			t.Fatalf("%s: read: %v", ext, err)
+		}
+
+		for _, position := range []float64{0, 0.5, 0.75, 1} {
+			expected, got := g.At(position), loaded.At(position)
+			if diff(expected.R, got.R) > 2 || diff(expected.G, got.G) > 2 || diff(expected.B, got.B) > 2 {
+				t.Errorf("%s: color at %f is %+v, expected %+v", ext, position, got, expected)
+			}
+		}
+
+		// stops are kept up to the format resolution
+		for _, stop := range g.GetStops() {
+			if !hasStop(loaded, stop.Position, 1.0/ugrPositions) {
+				t.Errorf("%s: stop at %f is moved", ext, stop.Position)
+			}
+		}
+
+		// and do not drift when the file is saved and loaded again
+		buf.Reset()
+		if err := format.Write(&buf, loaded); err != nil {
+			t.Fatalf("%s: write: %v", ext, err)
+		}
+		reloaded, err := format.Read(&buf)
+		if err != nil {
+			t.Fatalf("%s: read: %v", ext, err)
+		}
+		for _, stop := range loaded.GetStops() {
+			if !hasStop(reloaded, stop.Position, 1e-6) {
+				t.Errorf("%s: stop at %f is moved after saving again", ext, stop.Position)
+			}
+		}
+
+		if len(loaded.Palette(256)) != 256 {
+			t.Errorf("%s: palette of loaded gradient has wrong size", ext)
+		}
+	}
+}
+
+func TestGGRKeepsSegments(t *testing.T) {
+	// the second segment has its middle point moved, the third one starts with another color
+	data := "GIMP Gradient\nName: test\n3\n" +
+		"0 0.25 0.5 0 0 0 1 1 1 1 1 0 0\n" +
+		"0.5 0.6 0.75 1 1 1 1 1 0 0 1 0 0\n" +
+		"0.75 0.875 1 0 0 1 1 0 1 0 1 0 0\n"
+
+	format := &GGRFormat{}
+	g, err := format.Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if err := format.Write(&buf, g); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if lines[2] != "3" || len(lines) != 6 {
+			t.Fatalf("save %d: 3 segments expected, got:\n%s", i+1, buf.String())
+		}
+		if !strings.HasPrefix(lines[4], "0.500000 0.600000 0.750000 ") {
+			t.Errorf("save %d: middle point is moved: %s", i+1, lines[4])
+		}
+
+		stops := len(g.GetStops())
+		if g, err = format.Read(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if len(g.GetStops()) != stops {
+			t.Errorf("save %d: %d stops loaded, %d expected", i+1, len(g.GetStops()), stops)
+		}
+	}
+}
+
+func TestParseErrorLines(t *testing.T) {
+	tests := []struct {
+		format Format
+		data   string
+		line   int
+	}{
+		{&MapFormat{}, "0 0 0\n255 255 255\n1 2 x\n", 3},
+		{&CSVFormat{}, "#000000\n\n#zzzzzz\n", 3},
+		{&GGRFormat{}, "GIMP Gradient\nName: test\n2\n0 0.5 1 0 0 0 1 1 1 1 1 0 0\n", 4},
+		{&UGRFormat{}, "test {\ngradient:\n  index=0 color=0\n  index=500 color=0\n}\n", 4},
+		{&JSONFormat{}, "[\n  \"#000000\",\n  \"#00000\"\n]\n", 3},
+		{&JSONFormat{}, "[\n  \"#000000\",\n  \"#000000\"\n  \"#000000\"\n]\n", 4},
+	}
+
+	for i, test := range tests {
+		_, err := test.format.Read(strings.NewReader(test.data))
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("test %d: parse error expected, got %v", i, err)
+			continue
+		}
+
+		if parseErr.Line != test.line {
+			t.Errorf("test %d: error at line %d, expected %d: %v", i, parseErr.Line, test.line, err)
+		}
+	}
+}
+
+// Check that gradient has a stop near the position
+func hasStop(g *Gradient, position, tolerance float64) bool {
+	for _, stop := range g.GetStops() {
+		if math.Abs(stop.Position-position) <= tolerance+1e-9 {
+			return true
+		}
+	}
+	return false
+}
+
+func diff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
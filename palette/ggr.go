@@ -0,0 +1,168 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GGRFormat is a GIMP gradient.
+// Segment blending functions and HSV coloring are approximated by linear RGB blending
+// through the segment middle point
+type GGRFormat struct{}
+
+// Positions are written with 6 decimal places
+const ggrPrecision = 1e-6
+
+func (f *GGRFormat) Read(r io.Reader) (*Gradient, error) {
+	scanner := newLineScanner(r)
+
+	if !scanner.Scan() || scanner.Text() != "GIMP Gradient" {
+		return nil, parseErrorf(scanner.line, "\"GIMP Gradient\" header expected")
+	}
+
+	// optional name line, then number of segments
+	if !scanner.Scan() {
+		return nil, parseErrorf(scanner.line, "number of segments expected")
+	}
+	if strings.HasPrefix(scanner.Text(), "Name:") && !scanner.Scan() {
+		return nil, parseErrorf(scanner.line, "number of segments expected")
+	}
+
+	segments, err := strconv.Atoi(scanner.Text())
+	if err != nil || segments <= 0 {
+		return nil, parseErrorf(scanner.line, "invalid number of segments %q", scanner.Text())
+	}
+
+	ret := NewGradient(SpaceRGB, ModeClamp)
+
+	for i := 0; i < segments; i++ {
+		if !scanner.Scan() {
+			return nil, parseErrorf(scanner.line, "%d segments expected, %d found", segments, i)
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 11 {
+			return nil, parseErrorf(scanner.line, "segment must have at least 11 values")
+		}
+
+		var v [11]float64
+		for j := range v {
+			v[j], err = strconv.ParseFloat(fields[j], 64)
+			if err != nil {
+				return nil, parseErrorf(scanner.line, "invalid segment value %q", fields[j])
+			}
+		}
+
+		left, middle, right := v[0], v[1], v[2]
+		leftColor := floatColor(v[3], v[4], v[5], v[6])
+		rightColor := floatColor(v[7], v[8], v[9], v[10])
+
+		// segments usually share their ends, a stop is added only where the color changes
+		stops := ret.GetStops()
+		if len(stops) == 0 || stops[len(stops)-1] != (Stop{Position: left, Color: leftColor}) {
+			ret.AddStop(left, leftColor)
+		}
+		// the middle of the segment needs no stop, linear blending goes through it anyway
+		if math.Abs(middle-(left+right)/2) > ggrPrecision {
+			ret.AddStop(middle, gradientBetween(leftColor, rightColor).At(0.5))
+		}
+		ret.AddStop(right, rightColor)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (f *GGRFormat) Write(w io.Writer, g *Gradient) error {
+	stops := g.GetStops()
+	if len(stops) == 0 {
+		return fmt.Errorf("empty gradient")
+	}
+
+	// gradient without segments, like a single stop, is saved as a segment of a solid color
+	segments := ggrSegments(stops)
+	if len(segments) == 0 {
+		last := stops[len(stops)-1].Color
+		segments = []ggrSegment{{left: Stop{Position: 0, Color: last}, right: Stop{Position: 1, Color: last}, middle: 0.5}}
+	}
+
+	if _, err := fmt.Fprintf(w, "GIMP Gradient\nName: mandelbrot\n%d\n", len(segments)); err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		lr, lg, lb, la := componentsFloat(segment.left.Color)
+		rr, rg, rb, ra := componentsFloat(segment.right.Color)
+
+		_, err := fmt.Fprintf(w, "%f %f %f %f %f %f %f %f %f %f %f 0 0\n",
+			segment.left.Position, segment.middle, segment.right.Position,
+			lr, lg, lb, la,
+			rr, rg, rb, ra,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ggrSegment is a GIMP gradient segment blending linearly from left to right color
+// through the middle point, where the color is halfway between them
+type ggrSegment struct {
+	left, right Stop
+	middle      float64
+}
+
+// Convert stops into segments, so the segments read from a file are written back as they were.
+// Stops at the same position only change the color, they don't make a segment.
+// A stop halfway in color between its neighbors is the middle point of a segment
+func ggrSegments(stops []Stop) []ggrSegment {
+	var ret []ggrSegment
+	for i := 0; i < len(stops)-1; {
+		left, right := stops[i], stops[i+1]
+		if right.Position <= left.Position {
+			i++
+			continue
+		}
+
+		segment := ggrSegment{left: left, right: right, middle: (left.Position + right.Position) / 2}
+		if i+2 < len(stops) {
+			next := stops[i+2]
+			if next.Position > right.Position && right.Color == gradientBetween(left.Color, next.Color).At(0.5) {
+				segment.right, segment.middle = next, right.Position
+				i++
+			}
+		}
+
+		ret = append(ret, segment)
+		i++
+	}
+
+	return ret
+}
+
+// Create RGB gradient going from color a to color b
+func gradientBetween(a, b color.RGBA) *Gradient {
+	ret := NewGradient(SpaceRGB, ModeClamp)
+	ret.AddStop(0, a)
+	ret.AddStop(1, b)
+	return ret
+}
+
+// Convert color components in range [0, 1] into color
+func floatColor(r, g, b, a float64) color.RGBA {
+	return color.RGBA{R: toUint8(r), G: toUint8(g), B: toUint8(b), A: toUint8(a)}
+}
+
+// Convert color into components in range [0, 1]
+func componentsFloat(c color.RGBA) (float64, float64, float64, float64) {
+	return float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255, float64(c.A) / 255
+}
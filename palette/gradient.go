@@ -0,0 +1,207 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Mode defines how gradient positions outside of range [0, 1] are handled
+type Mode int
+
+const (
+	ModeClamp  Mode = iota // Use the first or the last stop color
+	ModeRepeat             // Start the gradient over
+	ModeMirror             // Go through the gradient backwards on every odd repeat
+)
+
+// Stop is a gradient control point
+type Stop struct {
+	Position float64 // Position in range [0, 1]
+	Color    color.RGBA
+}
+
+// Gradient is a palette defined by color stops interpolated in the given color space
+type Gradient struct {
+	stops   []Stop
+	space   Space
+	mode    Mode
+	repeats float64 // How many times the gradient fits into range [0, 1]
+}
+
+func NewGradient(space Space, mode Mode) *Gradient {
+	return &Gradient{
+		space:   space,
+		mode:    mode,
+		repeats: 1,
+	}
+}
+
+// AddStop adds a control point. Stops may be added in any order
+func (g *Gradient) AddStop(position float64, c color.RGBA) {
+	g.stops = append(g.stops, Stop{Position: position, Color: c})
+	sort.SliceStable(g.stops, func(i, j int) bool {
+		return g.stops[i].Position < g.stops[j].Position
+	})
+}
+
+// GetStops returns gradient control points ordered by position
+func (g *Gradient) GetStops() []Stop {
+	return g.stops
+}
+
+// SetSpace sets color space used for interpolation between stops
+func (g *Gradient) SetSpace(space Space) {
+	g.space = space
+}
+
+// SetMode sets the way positions outside of range [0, 1] are handled
+func (g *Gradient) SetMode(mode Mode) {
+	g.mode = mode
+}
+
+// SetRepeats sets how many times the gradient fits into the palette
+func (g *Gradient) SetRepeats(repeats float64) {
+	g.repeats = repeats
+}
+
+// At returns gradient color at position t
+func (g *Gradient) At(t float64) color.RGBA {
+	if len(g.stops) == 0 {
+		return color.RGBA{A: 255}
+	}
+
+	t = g.wrap(t * g.repeats)
+
+	first, last := g.stops[0], g.stops[len(g.stops)-1]
+	if t <= first.Position {
+		return first.Color
+	}
+	if t >= last.Position {
+		return last.Color
+	}
+
+	// find the stops around t
+	i := sort.Search(len(g.stops), func(i int) bool {
+		return g.stops[i].Position > t
+	})
+	left, right := g.stops[i-1], g.stops[i]
+
+	k := (t - left.Position) / (right.Position - left.Position)
+
+	a, b := toSpace(left.Color, g.space), toSpace(right.Color, g.space)
+	v := [3]float64{
+		a[0] + (b[0]-a[0])*k,
+		a[1] + (b[1]-a[1])*k,
+		a[2] + (b[2]-a[2])*k,
+	}
+	alpha := uint8(float64(left.Color.A) + (float64(right.Color.A)-float64(left.Color.A))*k + 0.5)
+
+	return fromSpace(v, alpha, g.space)
+}
+
+// Palette samples the gradient into a palette of the given size
+func (g *Gradient) Palette(values int) color.Palette {
+	ret := make([]color.Color, values)
+	for i := 0; i < values; i++ {
+		ret[i] = g.At(float64(i) / float64(values))
+	}
+
+	return ret
+}
+
+func (g *Gradient) wrap(t float64) float64 {
+	switch g.mode {
+	case ModeRepeat:
+		return t - math.Floor(t)
+	case ModeMirror:
+		t = math.Mod(math.Abs(t), 2)
+		if t > 1 {
+			return 2 - t
+		}
+		return t
+	default:
+		return math.Max(0, math.Min(1, t))
+	}
+}
+
+// ParseStops parses gradient stops from a string like "0:#000764,0.5:#ffffff,1:#000000"
+func ParseStops(s string) ([]Stop, error) {
+	var ret []Stop
+
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid gradient stop %q: position:color expected", item)
+		}
+
+		position, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gradient stop %q: %v", item, err)
+		}
+
+		c, err := ParseColor(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid gradient stop %q: %v", item, err)
+		}
+
+		ret = append(ret, Stop{Position: position, Color: c})
+	}
+
+	return ret, nil
+}
+
+// ParseColor parses color in #rrggbb or #rrggbbaa form
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 && len(s) != 8 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q: #rrggbb expected", s)
+	}
+
+	if len(s) == 6 {
+		s += "ff"
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	return color.RGBA{
+		R: uint8(v >> 24),
+		G: uint8(v >> 16),
+		B: uint8(v >> 8),
+		A: uint8(v),
+	}, nil
+}
+
+// ParseSpace parses color space name: rgb, oklab or lab
+func ParseSpace(s string) (Space, error) {
+	switch s {
+	case "rgb":
+		return SpaceRGB, nil
+	case "oklab":
+		return SpaceOKLab, nil
+	case "lab":
+		return SpaceLab, nil
+	default:
+		return 0, fmt.Errorf("unknown color space: %s", s)
+	}
+}
+
+// ParseMode parses gradient mode name: clamp, repeat or mirror
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "clamp":
+		return ModeClamp, nil
+	case "repeat":
+		return ModeRepeat, nil
+	case "mirror":
+		return ModeMirror, nil
+	default:
+		return 0, fmt.Errorf("unknown gradient mode: %s", s)
+	}
+}
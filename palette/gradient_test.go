@@ -0,0 +1,78 @@
+package palette
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestGradientStops(t *testing.T) {
+	for _, space := range []Space{SpaceRGB, SpaceOKLab, SpaceLab} {
+		g := NewGradient(space, ModeClamp)
+		g.AddStop(1, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+		g.AddStop(0, color.RGBA{R: 0, G: 7, B: 100, A: 255})
+
+		if got := g.At(0); got != (color.RGBA{R: 0, G: 7, B: 100, A: 255}) {
+			t.Errorf("space %d: color at 0 is %+v", space, got)
+		}
+
+		if got := g.At(1); got != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+			t.Errorf("space %d: color at 1 is %+v", space, got)
+		}
+	}
+}
+
+func TestColorSpaceRoundTrip(t *testing.T) {
+	colors := []color.RGBA{
+		{R: 0, G: 0, B: 0, A: 255},
+		{R: 255, G: 255, B: 255, A: 255},
+		{R: 237, G: 255, B: 255, A: 255},
+		{R: 255, G: 170, B: 0, A: 255},
+		{R: 32, G: 107, B: 203, A: 255},
+	}
+
+	for _, space := range []Space{SpaceOKLab, SpaceLab} {
+		for _, c := range colors {
+			if got := fromSpace(toSpace(c, space), c.A, space); got != c {
+				t.Errorf("space %d: %+v converted back to %+v", space, c, got)
+			}
+		}
+	}
+}
+
+func TestGradientModes(t *testing.T) {
+	black := color.RGBA{A: 255}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+
+	repeat := NewGradient(SpaceRGB, ModeRepeat)
+	repeat.AddStop(0, black)
+	repeat.AddStop(1, white)
+	repeat.SetRepeats(2)
+
+	if got := repeat.At(0.5); got != black {
+		t.Errorf("repeat: color at 0.5 is %+v", got)
+	}
+
+	mirror := NewGradient(SpaceRGB, ModeMirror)
+	mirror.AddStop(0, black)
+	mirror.AddStop(1, white)
+	mirror.SetRepeats(2)
+
+	if got := mirror.At(0.5); got != white {
+		t.Errorf("mirror: color at 0.5 is %+v", got)
+	}
+}
+
+func TestParseStops(t *testing.T) {
+	stops, err := ParseStops("0:#000764, 0.5:#ffffff80")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stops) != 2 || stops[1].Position != 0.5 || stops[1].Color != (color.RGBA{R: 255, G: 255, B: 255, A: 128}) {
+		t.Errorf("unexpected stops: %+v", stops)
+	}
+
+	if _, err := ParseStops("0:#00076"); err == nil {
+		t.Error("error expected for invalid color")
+	}
+}
@@ -0,0 +1,230 @@
+package palette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// CSVFormat is a simple color list, one color per line.
+// A line is either #rrggbb or r,g,b with components in range [0, 255], such colors are spread evenly,
+// or position,r,g,b with position in range [0, 1]
+type CSVFormat struct{}
+
+func (f *CSVFormat) Read(r io.Reader) (*Gradient, error) {
+	var stops []Stop
+	withPositions := false
+
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		if len(stops) == 0 {
+			withPositions = len(fields) == 4
+		} else if withPositions != (len(fields) == 4) {
+			return nil, parseErrorf(scanner.line, "either all or none of the colors must have positions")
+		}
+
+		var stop Stop
+		var err error
+
+		switch len(fields) {
+		case 1:
+			stop.Color, err = ParseColor(fields[0])
+			if err != nil {
+				return nil, parseErrorf(scanner.line, "%v", err)
+			}
+		case 3, 4:
+			if withPositions {
+				stop.Position, err = strconv.ParseFloat(fields[0], 64)
+				if err != nil {
+					return nil, parseErrorf(scanner.line, "invalid position %q", fields[0])
+				}
+				fields = fields[1:]
+			}
+
+			var rgb [3]uint8
+			for i := range rgb {
+				v, err := strconv.ParseUint(fields[i], 10, 8)
+				if err != nil {
+					return nil, parseErrorf(scanner.line, "invalid color component %q", fields[i])
+				}
+				rgb[i] = uint8(v)
+			}
+			stop.Color = color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}
+		default:
+			return nil, parseErrorf(scanner.line, "#rrggbb, r,g,b or position,r,g,b expected")
+		}
+
+		stops = append(stops, stop)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return stopsGradient(stops, withPositions)
+}
+
+func (f *CSVFormat) Write(w io.Writer, g *Gradient) error {
+	for _, stop := range g.GetStops() {
+		_, err := fmt.Fprintf(w, "%g,%d,%d,%d\n", stop.Position, stop.Color.R, stop.Color.G, stop.Color.B)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// JSONFormat is a JSON array of colors. Array items are either "#rrggbb" strings,
+// which are spread evenly, or {"position": 0.5, "color": "#rrggbb"} objects
+type JSONFormat struct{}
+
+type jsonStop struct {
+	Position *float64 `json:"position"`
+	Color    string   `json:"color"`
+}
+
+func (f *JSONFormat) Read(r io.Reader) (*Gradient, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, jsonError(data, err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, parseErrorf(1, "array of colors expected")
+	}
+
+	var stops []Stop
+	withPositions := false
+
+	for decoder.More() {
+		line := lineAt(data, jsonItemOffset(data, decoder.InputOffset()))
+
+		var item json.RawMessage
+		if err := decoder.Decode(&item); err != nil {
+			return nil, jsonError(data, err)
+		}
+
+		var stop jsonStop
+		if bytes.HasPrefix(item, []byte("\"")) {
+			err = json.Unmarshal(item, &stop.Color)
+		} else {
+			err = json.Unmarshal(item, &stop)
+		}
+		if err != nil {
+			return nil, parseErrorf(line, "%v", err)
+		}
+
+		if len(stops) == 0 {
+			withPositions = stop.Position != nil
+		} else if withPositions != (stop.Position != nil) {
+			return nil, parseErrorf(line, "either all or none of the colors must have positions")
+		}
+
+		c, err := ParseColor(stop.Color)
+		if err != nil {
+			return nil, parseErrorf(line, "%v", err)
+		}
+
+		ret := Stop{Color: c}
+		if stop.Position != nil {
+			ret.Position = *stop.Position
+		}
+		stops = append(stops, ret)
+	}
+
+	return stopsGradient(stops, withPositions)
+}
+
+func (f *JSONFormat) Write(w io.Writer, g *Gradient) error {
+	items := make([]jsonStop, 0, len(g.GetStops()))
+	for _, stop := range g.GetStops() {
+		position := stop.Position
+		items = append(items, jsonStop{
+			Position: &position,
+			Color:    fmt.Sprintf("#%02x%02x%02x", stop.Color.R, stop.Color.G, stop.Color.B),
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(items)
+}
+
+// Create gradient from parsed stops, stops without positions are spread evenly
+func stopsGradient(stops []Stop, withPositions bool) (*Gradient, error) {
+	if len(stops) == 0 {
+		return nil, fmt.Errorf("no colors found")
+	}
+
+	if !withPositions {
+		colors := make([]color.RGBA, len(stops))
+		for i := range stops {
+			colors[i] = stops[i].Color
+		}
+		return evenGradient(colors), nil
+	}
+
+	ret := NewGradient(SpaceRGB, ModeClamp)
+	for _, stop := range stops {
+		ret.AddStop(stop.Position, stop.Color)
+	}
+
+	return ret, nil
+}
+
+// Convert JSON decoding error into ParseError when error offset is known
+func jsonError(data []byte, err error) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return parseErrorf(lineAt(data, e.Offset), "%v", err)
+	case *json.UnmarshalTypeError:
+		return parseErrorf(lineAt(data, e.Offset), "%v", err)
+	default:
+		return err
+	}
+}
+
+// Decoder offset points right after the previous token,
+// skip separators to get the offset of the next array item
+func jsonItemOffset(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) && strings.ContainsRune(" \t\r\n,", rune(data[offset])) {
+		offset++
+	}
+
+	return offset
+}
+
+// Return 1-based line number of the byte offset
+func lineAt(data []byte, offset int64) int {
+	if offset < 0 {
+		return 0
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,63 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Number of colors in Fractint palette
+const mapColors = 256
+
+// MapFormat is a Fractint .map palette: one "r g b" line per color, text after the color is a comment
+type MapFormat struct{}
+
+func (f *MapFormat) Read(r io.Reader) (*Gradient, error) {
+	var colors []color.RGBA
+
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, parseErrorf(scanner.line, "r g b expected: %q", line)
+		}
+
+		var rgb [3]uint8
+		for i := range rgb {
+			v, err := strconv.ParseUint(fields[i], 10, 8)
+			if err != nil {
+				return nil, parseErrorf(scanner.line, "invalid color component %q", fields[i])
+			}
+			rgb[i] = uint8(v)
+		}
+
+		colors = append(colors, color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(colors) == 0 {
+		return nil, fmt.Errorf("no colors found")
+	}
+
+	return evenGradient(colors), nil
+}
+
+func (f *MapFormat) Write(w io.Writer, g *Gradient) error {
+	for _, c := range evenColors(g, mapColors) {
+		if _, err := fmt.Fprintf(w, "%3d %3d %3d\n", c.R, c.G, c.B); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
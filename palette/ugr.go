@@ -0,0 +1,129 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Number of gradient positions in UltraFractal gradient
+const ugrPositions = 400
+
+// UGRFormat is an UltraFractal gradient collection. Only the first gradient of the file is read.
+// Colors are stored as decimal numbers in BGR order: b<<16 | g<<8 | r
+type UGRFormat struct{}
+
+func (f *UGRFormat) Read(r io.Reader) (*Gradient, error) {
+	ret := NewGradient(SpaceRGB, ModeClamp)
+
+	type section int
+	const (
+		sectionNone section = iota
+		sectionGradient
+		sectionOther
+	)
+
+	current := sectionNone
+	opened := false
+	index := -1
+
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if !opened {
+			if !strings.HasSuffix(line, "{") {
+				return nil, parseErrorf(scanner.line, "gradient name followed by { expected")
+			}
+			opened = true
+			continue
+		}
+
+		if line == "}" {
+			break
+		}
+
+		if strings.HasSuffix(line, ":") {
+			if line == "gradient:" {
+				current = sectionGradient
+			} else {
+				current = sectionOther
+			}
+			continue
+		}
+
+		if current != sectionGradient {
+			continue
+		}
+
+		for _, field := range strings.Fields(line) {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			switch parts[0] {
+			case "index":
+				v, err := strconv.Atoi(parts[1])
+				if err != nil || v < 0 || v >= ugrPositions {
+					return nil, parseErrorf(scanner.line, "invalid index %q", parts[1])
+				}
+				index = v
+			case "color":
+				if index < 0 {
+					return nil, parseErrorf(scanner.line, "color without index")
+				}
+				v, err := strconv.ParseUint(parts[1], 10, 32)
+				if err != nil {
+					return nil, parseErrorf(scanner.line, "invalid color %q", parts[1])
+				}
+				ret.AddStop(float64(index)/ugrPositions, color.RGBA{
+					R: uint8(v),
+					G: uint8(v >> 8),
+					B: uint8(v >> 16),
+					A: 255,
+				})
+				index = -1
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ret.GetStops()) == 0 {
+		return nil, fmt.Errorf("no colors found")
+	}
+
+	return ret, nil
+}
+
+func (f *UGRFormat) Write(w io.Writer, g *Gradient) error {
+	if _, err := fmt.Fprintf(w, "mandelbrot {\ngradient:\n  title=\"mandelbrot\" smooth=yes\n"); err != nil {
+		return err
+	}
+
+	for _, stop := range g.GetStops() {
+		// the same scale as in Read, the last index holds the gradient end
+		index := int(stop.Position*ugrPositions + 0.5)
+		if index >= ugrPositions {
+			index = ugrPositions - 1
+		} else if index < 0 {
+			index = 0
+		}
+		value := uint32(stop.Color.B)<<16 | uint32(stop.Color.G)<<8 | uint32(stop.Color.R)
+		if _, err := fmt.Fprintf(w, "  index=%d color=%d\n", index, value); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "opacity:\n  smooth=no index=0 opacity=255\n}\n")
+
+	return err
+}
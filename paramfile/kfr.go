@@ -0,0 +1,86 @@
+package paramfile
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kalles Fraktaler view radius at zoom 1, it is half of the view height
+const kfrRadius = 2
+
+// Kalles Fraktaler location file consists of "Key: value" lines
+func parseKFR(text string, precision uint) (*Location, error) {
+	values := map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.Index(line, ":"); i > 0 {
+			values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+	}
+
+	if t, ok := values["FractalType"]; ok && t != "0" {
+		return nil, fmt.Errorf("kfr: fractal type %s is not the Mandelbrot set", t)
+	}
+	if p, ok := values["Power"]; ok && p != "2" {
+		return nil, fmt.Errorf("kfr: power %s is not the Mandelbrot set", p)
+	}
+
+	for _, key := range []string{"Re", "Im", "Zoom"} {
+		if values[key] == "" {
+			return nil, fmt.Errorf("kfr: %s is missing", key)
+		}
+	}
+
+	ret := &Location{Name: defaultName}
+	var err error
+	if ret.CX, err = parseDecimal(values["Re"], precision); err != nil {
+		return nil, fmt.Errorf("kfr: Re: %v", err)
+	}
+	if ret.CY, err = parseDecimal(values["Im"], precision); err != nil {
+		return nil, fmt.Errorf("kfr: Im: %v", err)
+	}
+
+	zoom, err := parseDecimal(values["Zoom"], maxPrec(ret.CX, ret.CY))
+	if err != nil {
+		return nil, fmt.Errorf("kfr: Zoom: %v", err)
+	}
+	if zoom.Sign() <= 0 {
+		return nil, fmt.Errorf("kfr: zoom must be positive: %s", values["Zoom"])
+	}
+	ret.Scale = inverse(kfrRadius, zoom)
+
+	if s, ok := values["Iterations"]; ok {
+		if ret.Iterations, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("kfr: Iterations: %v", err)
+		}
+	}
+
+	if s, ok := values["Rotate"]; ok {
+		angle, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("kfr: Rotate: %v", err)
+		}
+		ret.Rotation = angle * math.Pi / 180
+	}
+
+	return ret, nil
+}
+
+func formatKFR(loc *Location) string {
+	// exponents are written like 1E50, the way Kalles Fraktaler writes them
+	zoom := strings.Replace(strings.ToUpper(derivedText(inverse(kfrRadius, loc.Scale))), "E+", "E", 1)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Re: %s\r\n", exactText(loc.CX))
+	fmt.Fprintf(&b, "Im: %s\r\n", exactText(loc.CY))
+	fmt.Fprintf(&b, "Zoom: %s\r\n", zoom)
+	if loc.Iterations > 0 {
+		fmt.Fprintf(&b, "Iterations: %d\r\n", loc.Iterations)
+	}
+	fmt.Fprintf(&b, "Rotate: %s\r\n", degrees(loc.Rotation))
+	b.WriteString("FractalType: 0\r\n")
+	b.WriteString("Power: 2\r\n")
+
+	return b.String()
+}
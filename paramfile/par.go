@@ -0,0 +1,259 @@
+package paramfile
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Fractint shows the vertical extent of 2 at magnification 1 on a screen of this aspect
+const parAspect = 4.0 / 3.0
+
+// Fractint types of the Mandelbrot set, integer and floating point ones
+var parMandelTypes = map[string]bool{"mandel": true, "mandelfp": true}
+
+// parEntry is a named entry of a parameter file
+type parEntry struct {
+	name   string
+	params map[string]string
+}
+
+// Split parameter file into entries like "name { key=value ... }".
+// Semicolons start comments, a backslash at the end of a line continues the value on the next line
+func parseParEntries(text string) ([]parEntry, error) {
+	var b strings.Builder
+	continued := false
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		if continued {
+			line = strings.TrimLeft(line, " \t")
+		}
+
+		line = strings.TrimRight(line, " \t")
+		continued = strings.HasSuffix(line, "\\")
+		b.WriteString(strings.TrimSuffix(line, "\\"))
+		if !continued {
+			b.WriteString("\n")
+		}
+	}
+
+	words := strings.Fields(strings.NewReplacer("{", " { ", "}", " } ").Replace(b.String()))
+
+	var ret []parEntry
+	for i := 0; i < len(words); i++ {
+		if i+1 >= len(words) || words[i+1] != "{" {
+			return nil, fmt.Errorf("par: entry name expected before %q", words[i])
+		}
+
+		entry := parEntry{name: words[i], params: map[string]string{}}
+		i += 2
+		for ; i < len(words) && words[i] != "}"; i++ {
+			kv := strings.SplitN(words[i], "=", 2)
+			value := ""
+			if len(kv) == 2 {
+				value = kv[1]
+			}
+			entry.params[strings.ToLower(kv[0])] = value
+		}
+		if i >= len(words) {
+			return nil, fmt.Errorf("par: entry %s is not closed", entry.name)
+		}
+
+		ret = append(ret, entry)
+	}
+
+	return ret, nil
+}
+
+func parsePar(text, name string, precision uint) (*Location, error) {
+	entries, err := parseParEntries(text)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if name != "" && !strings.EqualFold(entry.name, name) {
+			continue
+		}
+
+		if !parMandelTypes[strings.ToLower(entry.params["type"])] {
+			if name != "" {
+				return nil, fmt.Errorf("par: entry %s of type %s is not the Mandelbrot set", entry.name, entry.params["type"])
+			}
+			continue
+		}
+
+		loc, err := parseParEntry(entry, precision)
+		if err != nil {
+			return nil, fmt.Errorf("par: entry %s: %v", entry.name, err)
+		}
+
+		return loc, nil
+	}
+
+	if name != "" {
+		return nil, fmt.Errorf("par: entry %s is not found", name)
+	}
+
+	return nil, fmt.Errorf("par: no Mandelbrot entries")
+}
+
+func parseParEntry(entry parEntry, precision uint) (*Location, error) {
+	ret := &Location{Name: entry.name}
+
+	if p, ok := entry.params["params"]; ok {
+		for _, v := range strings.Split(p, "/") {
+			if f, err := strconv.ParseFloat(v, 64); err != nil || f != 0 {
+				return nil, fmt.Errorf("perturbation params=%s is not supported", p)
+			}
+		}
+	}
+
+	if s, ok := entry.params["maxiter"]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("maxiter: %v", err)
+		}
+		ret.Iterations = n
+	}
+
+	if s, ok := entry.params["center-mag"]; ok {
+		return ret, parseCenterMag(ret, s, precision)
+	}
+	if s, ok := entry.params["corners"]; ok {
+		return ret, parseCorners(ret, s, precision)
+	}
+
+	return nil, fmt.Errorf("center-mag or corners is missing")
+}
+
+// center-mag=Xctr/Yctr/Mag[/Xmagfactor/Rotation/Skew]
+func parseCenterMag(loc *Location, s string, precision uint) error {
+	parts := strings.Split(s, "/")
+	if len(parts) < 3 {
+		return fmt.Errorf("invalid center-mag %q", s)
+	}
+
+	var err error
+	if loc.CX, err = parseDecimal(parts[0], precision); err != nil {
+		return err
+	}
+	if loc.CY, err = parseDecimal(parts[1], precision); err != nil {
+		return err
+	}
+
+	mag, err := parseDecimal(parts[2], maxPrec(loc.CX, loc.CY))
+	if err != nil {
+		return err
+	}
+	if mag.Sign() <= 0 {
+		return fmt.Errorf("magnification must be positive: %s", parts[2])
+	}
+	loc.Scale = inverse(1, mag)
+
+	extra := make([]float64, 3)
+	for i, part := range parts[3:] {
+		if i >= len(extra) {
+			return fmt.Errorf("invalid center-mag %q", s)
+		}
+		if extra[i], err = strconv.ParseFloat(part, 64); err != nil {
+			return fmt.Errorf("invalid center-mag %q: %v", s, err)
+		}
+	}
+
+	xMagFactor, rotation, skew := extra[0], extra[1], extra[2]
+	if xMagFactor == 0 {
+		xMagFactor = 1
+	}
+	if skew != 0 {
+		return fmt.Errorf("skewed view is not supported")
+	}
+
+	loc.Aspect = parAspect / xMagFactor
+	loc.Rotation = rotation * math.Pi / 180
+
+	return nil
+}
+
+// corners=Xmin/Xmax/Ymin/Ymax[/X3rd/Y3rd]
+func parseCorners(loc *Location, s string, precision uint) error {
+	parts := strings.Split(s, "/")
+	if len(parts) != 4 && len(parts) != 6 {
+		return fmt.Errorf("invalid corners %q", s)
+	}
+
+	values := make([]*big.Float, len(parts))
+	for i, part := range parts {
+		v, err := parseDecimal(part, precision)
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+	if len(values) == 6 && (values[4].Cmp(values[0]) != 0 || values[5].Cmp(values[2]) != 0) {
+		return fmt.Errorf("rotated or skewed corners are not supported, use center-mag")
+	}
+
+	prec := maxPrec(values...)
+	half := big.NewFloat(0.5)
+	width := new(big.Float).SetPrec(prec).Sub(values[1], values[0])
+	height := new(big.Float).SetPrec(prec).Sub(values[3], values[2])
+	if width.Sign() <= 0 || height.Sign() <= 0 {
+		return fmt.Errorf("invalid corners %q", s)
+	}
+
+	loc.CX = new(big.Float).SetPrec(prec).Add(values[0], values[1])
+	loc.CX.Mul(loc.CX, half)
+	loc.CY = new(big.Float).SetPrec(prec).Add(values[2], values[3])
+	loc.CY.Mul(loc.CY, half)
+	loc.Scale = height.Mul(height, half)
+
+	w, _ := width.Float64()
+	h, _ := loc.Scale.Float64()
+	loc.Aspect = w / (2 * h)
+
+	return nil
+}
+
+// Longest line written to parameter files, longer values are continued with backslashes like Fractint does
+const parLineLength = 78
+
+func writeParValue(b *strings.Builder, key, value string) {
+	line := "  " + key + "=" + value
+	for len(line) > parLineLength {
+		b.WriteString(line[:parLineLength-1] + "\\\n")
+		line = "  " + line[parLineLength-1:]
+	}
+	b.WriteString(line + "\n")
+}
+
+func formatPar(loc *Location) string {
+	name := loc.Name
+	if name == "" {
+		name = defaultName
+	}
+
+	centerMag := fmt.Sprintf("%s/%s/%s", exactText(loc.CX), exactText(loc.CY), derivedText(inverse(1, loc.Scale)))
+	if loc.Rotation != 0 || (loc.Aspect != 0 && loc.Aspect != parAspect) {
+		xMagFactor := 1.0
+		if loc.Aspect != 0 {
+			xMagFactor = parAspect / loc.Aspect
+		}
+		centerMag += fmt.Sprintf("/%g/%s", xMagFactor, degrees(loc.Rotation))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s {\n", strings.Replace(name, " ", "_", -1))
+	fmt.Fprintf(&b, "  reset=2004 type=mandel\n")
+	writeParValue(&b, "center-mag", centerMag)
+	if loc.Iterations > 0 {
+		fmt.Fprintf(&b, "  maxiter=%d\n", loc.Iterations)
+	}
+	b.WriteString("  }\n")
+
+	return b.String()
+}
@@ -0,0 +1,142 @@
+// Package paramfile reads and writes locations in parameter files of other fractal explorers:
+// Kalles Fraktaler .kfr, Fractint .par and XaoS .xpf position files
+package paramfile
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"path/filepath"
+	"strings"
+)
+
+// Formats by file extensions
+const (
+	FormatKFR   = "kfr"
+	FormatPar   = "par"
+	FormatXaoS  = "xpf"
+	defaultName = "mandelbrot"
+)
+
+// Location is a view of the Mandelbrot set
+type Location struct {
+	Name       string     // Entry name, used by Fractint parameter files
+	CX, CY     *big.Float // Center
+	Scale      *big.Float // Half of the view height, like the viewer state scale
+	Aspect     float64    // Width to height ratio of the view, zero if the file does not define it
+	Rotation   float64    // Counterclockwise view rotation, radians
+	Iterations int        // Iterations limit, zero if the file does not define it
+}
+
+// FormatOf selects format by the file extension
+func FormatOf(path string) (string, error) {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); ext {
+	case FormatKFR, FormatPar, FormatXaoS:
+		return ext, nil
+	default:
+		return "", fmt.Errorf("unknown parameter file format: %s", path)
+	}
+}
+
+// Read location of the format. Numbers are parsed with at least the given precision,
+// longer numbers get enough precision to keep all their digits.
+// Name selects an entry of Fractint parameter files, empty name selects the first Mandelbrot entry
+func Read(r io.Reader, format, name string, precision uint) (*Location, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatKFR:
+		return parseKFR(string(data), precision)
+	case FormatPar:
+		return parsePar(string(data), name, precision)
+	case FormatXaoS:
+		return parseXaoS(string(data), precision)
+	default:
+		return nil, fmt.Errorf("unknown parameter file format: %s", format)
+	}
+}
+
+// Write location in the format
+func Write(w io.Writer, format string, loc *Location) error {
+	var text string
+	switch format {
+	case FormatKFR:
+		text = formatKFR(loc)
+	case FormatPar:
+		text = formatPar(loc)
+	case FormatXaoS:
+		text = formatXaoS(loc)
+	default:
+		return fmt.Errorf("unknown parameter file format: %s", format)
+	}
+
+	_, err := io.WriteString(w, text)
+	return err
+}
+
+// Parse decimal number keeping all its digits. Precision is raised only for numbers clearly longer
+// than it allows, so numbers written at a precision are parsed back to the same values at it
+func parseDecimal(s string, precision uint) (*big.Float, error) {
+	if bits := uint(float64(len(s)) * math.Log2(10)); bits > precision+64 {
+		precision = bits
+	}
+
+	f, _, err := big.ParseFloat(s, 10, precision, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q: %v", s, err)
+	}
+
+	return f, nil
+}
+
+// Precision of the most precise value
+func maxPrec(values ...*big.Float) uint {
+	var ret uint
+	for _, v := range values {
+		if v.Prec() > ret {
+			ret = v.Prec()
+		}
+	}
+
+	return ret
+}
+
+// Divide k by x at the precision of x, used to convert between scale and magnifications
+func inverse(k float64, x *big.Float) *big.Float {
+	ret := big.NewFloat(k).SetPrec(x.Prec())
+	return ret.Quo(ret, x)
+}
+
+// Shortest decimal text parsed back to the same value at its precision
+func exactText(f *big.Float) string {
+	return f.Text('g', -1)
+}
+
+// Decimal text of a derived value like magnification. It is computed by division,
+// so the last bits are not exact and are rounded off
+func derivedText(f *big.Float) string {
+	digits := int(float64(f.Prec())*math.Log10(2)) - 4
+	if digits < 17 {
+		digits = 17
+	}
+
+	// large and small values are shorter in the exponent form without trailing zeros
+	text := f.Text('g', digits)
+	mantissa := strings.SplitN(f.Text('e', digits-1), "e", 2)
+	exp := strings.TrimRight(strings.TrimRight(mantissa[0], "0"), ".") + "e" + mantissa[1]
+	if len(exp) < len(text) {
+		return exp
+	}
+
+	return text
+}
+
+// Rotation in degrees written without noise of radians conversion
+func degrees(radians float64) string {
+	return fmt.Sprintf("%g", math.Round(radians*180/math.Pi*1e9)/1e9)
+}
@@ -0,0 +1,155 @@
+package paramfile
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+const (
+	deepCX = "-1.768610493014677074503175653270226520239677907588665494812359766"
+	deepCY = "0.00237167729737126071006708926248843437834142587399011519815"
+)
+
+func mustParse(t *testing.T, s string) *big.Float {
+	f, err := parseDecimal(s, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// Check that values differ by less than 2^exp relatively
+func near(a, b *big.Float, exp int) bool {
+	diff := new(big.Float).SetPrec(a.Prec()).Sub(a, b)
+	if diff.Sign() == 0 {
+		return true
+	}
+	diff.Quo(diff, b)
+
+	return diff.Abs(diff).Cmp(new(big.Float).SetMantExp(big.NewFloat(1), exp)) < 0
+}
+
+func TestReadFormats(t *testing.T) {
+	tests := []struct {
+		format     string
+		name       string
+		text       string
+		cx, cy     string
+		scale      string
+		aspect     float64
+		rotation   float64
+		iterations int
+	}{
+		{
+			format: FormatKFR,
+			text: "Re: " + deepCX + "\r\nIm: " + deepCY + "\r\nZoom: 2E50\r\nIterations: 12000\r\n" +
+				"Rotate: 90\r\nimag: 1\r\nreal: 1\r\nFractalType: 0\r\nPower: 2\r\n",
+			cx: deepCX, cy: deepCY, scale: "1e-50", rotation: math.Pi / 2, iterations: 12000,
+		},
+		{
+			format: FormatPar,
+			name:   "second",
+			text: "first { ; a Julia set\n  reset=2004 type=julia corners=-2/2/-1.5/1.5\n  }\n" +
+				"second { ; deep location\n  reset=2004 type=mandel\n  center-mag=" + deepCX[:40] + "\\\n" +
+				"  " + deepCX[40:] + "/" + deepCY + "/1e20/1/45 maxiter=5000\n}\n",
+			cx: deepCX, cy: deepCY, scale: "1e-20", aspect: 4.0 / 3, rotation: math.Pi / 4, iterations: 5000,
+		},
+		{
+			format: FormatPar,
+			text:   "julia { type=julia center-mag=0/0/1 }\nwhole { type=mandelfp corners=-2.5/1.5/-1.5/1.5 }\n",
+			cx:     "-0.5", cy: "0", scale: "1.5", aspect: 4.0 / 3,
+		},
+		{
+			format: FormatXaoS,
+			text: ";; Position file generated by XaoS\n(initstate)\n(defaultpalette 0)\n(formula 'mandel)\n" +
+				"(view " + deepCX + " " + deepCY + " 4E-30 3E-30)\n(angle -30)\n(maxiter 700)\n",
+			cx: deepCX, cy: deepCY, scale: "1.5e-30", aspect: 4.0 / 3, rotation: -math.Pi / 6, iterations: 700,
+		},
+	}
+
+	for i, test := range tests {
+		loc, err := Read(strings.NewReader(test.text), test.format, test.name, 256)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+
+		// all the digits are kept, the center is parsed more precisely than float64
+		if !near(loc.CX, mustParse(t, test.cx), -200) || !near(loc.CY, mustParse(t, test.cy), -200) {
+			t.Errorf("test %d: center %s %s, expected %s %s", i, loc.CX.Text('g', -1), loc.CY.Text('g', -1), test.cx, test.cy)
+		}
+		if !near(loc.Scale, mustParse(t, test.scale), -60) {
+			t.Errorf("test %d: scale %s, expected %s", i, loc.Scale.Text('g', 30), test.scale)
+		}
+		if math.Abs(loc.Aspect-test.aspect) > 1e-12 || math.Abs(loc.Rotation-test.rotation) > 1e-12 || loc.Iterations != test.iterations {
+			t.Errorf("test %d: aspect %g, rotation %g, iterations %d", i, loc.Aspect, loc.Rotation, loc.Iterations)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		text   string
+	}{
+		{FormatKFR, "Re: 0\nIm: 0\n"},
+		{FormatKFR, "Re: 0\nIm: 0\nZoom: 1\nFractalType: 3\n"},
+		{FormatPar, "julia { type=julia center-mag=0/0/1 }\n"},
+		{FormatPar, "broken { type=mandel center-mag=0/0/1\n"},
+		{FormatPar, "skewed { type=mandel center-mag=0/0/1/1/0/10 }\n"},
+		{FormatXaoS, "(formula 'julia)\n(view 0 0 1 1)\n"},
+		{FormatXaoS, "(maxiter 100)\n"},
+	}
+
+	for i, test := range tests {
+		if _, err := Read(strings.NewReader(test.text), test.format, "", 256); err == nil {
+			t.Errorf("test %d: error expected", i)
+		}
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	scale := mustParse(t, "1e-45")
+	scale.SetPrec(800).Quo(scale, big.NewFloat(3))
+
+	loc := &Location{
+		Name:       "deep",
+		CX:         mustParse(t, deepCX).SetPrec(800),
+		CY:         mustParse(t, deepCY).SetPrec(800),
+		Scale:      scale,
+		Aspect:     16.0 / 9,
+		Rotation:   math.Pi / 3,
+		Iterations: 4321,
+	}
+
+	for _, format := range []string{FormatKFR, FormatPar, FormatXaoS} {
+		var buf bytes.Buffer
+		if err := Write(&buf, format, loc); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := Read(&buf, format, "", 800)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if got.CX.Cmp(loc.CX) != 0 || got.CY.Cmp(loc.CY) != 0 {
+			t.Errorf("%s: center is changed", format)
+		}
+
+		// scale is converted to magnification and back, so only the last bits may differ
+		if !near(got.Scale, loc.Scale, -780) {
+			t.Errorf("%s: scale %s, expected %s", format, got.Scale.Text('g', 40), loc.Scale.Text('g', 40))
+		}
+
+		if math.Abs(got.Rotation-loc.Rotation) > 1e-9 || got.Iterations != loc.Iterations {
+			t.Errorf("%s: rotation %g, iterations %d", format, got.Rotation, got.Iterations)
+		}
+		if format != FormatKFR && math.Abs(got.Aspect-loc.Aspect) > 1e-12 {
+			t.Errorf("%s: aspect %g", format, got.Aspect)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package paramfile
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// XaoS position file is a sequence of commands like (view cx cy width height).
+// Semicolons start comments. Commands are applied in order, so the last view wins
+func parseXaoS(text string, precision uint) (*Location, error) {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		b.WriteString(line + "\n")
+	}
+	words := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(b.String()))
+
+	ret := &Location{Name: defaultName}
+	var view []string
+	for i := 0; i < len(words); i++ {
+		if words[i] != "(" {
+			continue
+		}
+
+		var args []string
+		j := i + 1
+		for ; j < len(words) && words[j] != ")"; j++ {
+			args = append(args, words[j])
+		}
+		if j >= len(words) || len(args) == 0 {
+			return nil, fmt.Errorf("xaos: unclosed command")
+		}
+		i = j
+
+		switch command := args[0]; command {
+		case "formula":
+			if len(args) != 2 || strings.TrimPrefix(args[1], "'") != "mandel" {
+				return nil, fmt.Errorf("xaos: formula %s is not the Mandelbrot set", strings.Join(args[1:], " "))
+			}
+		case "view":
+			if len(args) != 5 {
+				return nil, fmt.Errorf("xaos: view needs 4 values")
+			}
+			view = args[1:]
+		case "maxiter":
+			if len(args) != 2 {
+				return nil, fmt.Errorf("xaos: invalid maxiter")
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("xaos: maxiter: %v", err)
+			}
+			ret.Iterations = n
+		case "angle":
+			if len(args) != 2 {
+				return nil, fmt.Errorf("xaos: invalid angle")
+			}
+			angle, err := strconv.ParseFloat(args[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("xaos: angle: %v", err)
+			}
+			ret.Rotation = angle * math.Pi / 180
+		}
+	}
+
+	if view == nil {
+		return nil, fmt.Errorf("xaos: view is missing")
+	}
+
+	values := make([]*big.Float, len(view))
+	for i, s := range view {
+		v, err := parseDecimal(s, precision)
+		if err != nil {
+			return nil, fmt.Errorf("xaos: view: %v", err)
+		}
+		values[i] = v
+	}
+	if values[2].Sign() <= 0 || values[3].Sign() <= 0 {
+		return nil, fmt.Errorf("xaos: view size must be positive")
+	}
+
+	// view size is the whole width and height
+	ret.CX, ret.CY = values[0], values[1]
+	ret.Scale = values[3].Mul(values[3], big.NewFloat(0.5))
+
+	w, _ := values[2].Float64()
+	h, _ := ret.Scale.Float64()
+	ret.Aspect = w / (2 * h)
+
+	return ret, nil
+}
+
+func formatXaoS(loc *Location) string {
+	aspect := loc.Aspect
+	if aspect == 0 {
+		aspect = 1
+	}
+
+	height := new(big.Float).SetPrec(loc.Scale.Prec()).Mul(loc.Scale, big.NewFloat(2))
+	width := new(big.Float).SetPrec(loc.Scale.Prec()).Mul(height, big.NewFloat(aspect))
+
+	// width is only as precise as the aspect, the height keeps the scale
+	var b strings.Builder
+	b.WriteString(";; Position file\n")
+	b.WriteString("(initstate)\n")
+	b.WriteString("(formula 'mandel)\n")
+	fmt.Fprintf(&b, "(view %s %s %s %s)\n", exactText(loc.CX), exactText(loc.CY), width.Text('g', 17), exactText(height))
+	if loc.Rotation != 0 {
+		fmt.Fprintf(&b, "(angle %s)\n", degrees(loc.Rotation))
+	}
+	if loc.Iterations > 0 {
+		fmt.Fprintf(&b, "(maxiter %d)\n", loc.Iterations)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mandelbrot/paramfile"
+	"math/big"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Read location file of another explorer like Kalles Fraktaler, Fractint or XaoS, format is selected by the extension.
+// Entry selects an entry of Fractint parameter files. The view is fitted into the screen of the given size.
+// Iterations limit of the file is returned, zero if the file has none
+func importState(path, entry string, width, height int) (*State, int, error) {
+	format, err := paramfile.FormatOf(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	loc, err := paramfile.Read(f, format, entry, DefaultFloatsPrecision)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, path)
+	}
+
+	// scale is the half of the view height, wider views are fitted by their width
+	scale := loc.Scale
+	if screenAspect := float64(width) / float64(height); loc.Aspect > screenAspect {
+		scale = big.NewFloat(0).SetPrec(scale.Prec()).Mul(scale, big.NewFloat(loc.Aspect/screenAspect))
+	}
+
+	state, err := NewStateScale(loc.CX, loc.CY, scale, width, height)
+	if err != nil {
+		return nil, 0, err
+	}
+	state.SetRotation(loc.Rotation)
+
+	return state, loc.Iterations, nil
+}
+
+// Write the state view as a location file of another explorer, format is selected by the extension
+func exportState(path string, state *State, name string, iterations int) error {
+	format, err := paramfile.FormatOf(path)
+	if err != nil {
+		return err
+	}
+
+	aspect, _ := big.NewFloat(0).Quo(state.GetPhysicalWidth(), state.GetPhysicalHeight()).Float64()
+	loc := &paramfile.Location{
+		Name:       name,
+		CX:         state.GetCX(),
+		CY:         state.GetCY(),
+		Scale:      state.GetScale(),
+		Aspect:     aspect,
+		Rotation:   state.GetRotation(),
+		Iterations: iterations,
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = paramfile.Write(f, format, loc)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return errors.Wrap(err, path)
+}
+
+// convert subcommand: convert location files between Kalles Fraktaler, Fractint and XaoS formats
+func convertCommand(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	entry := fs.String("entry", "", "entry of the Fractint parameter file, the first Mandelbrot entry if empty")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: %s convert [options] <input> <output>\n"+
+			"Formats are selected by extensions: .kfr (Kalles Fraktaler), .par (Fractint), .xpf (XaoS)\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	inputFormat, err := paramfile.FormatOf(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	outputFormat, err := paramfile.FormatOf(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	loc, err := paramfile.Read(in, inputFormat, *entry, DefaultFloatsPrecision)
+	if err != nil {
+		return errors.Wrap(err, fs.Arg(0))
+	}
+
+	out, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	err = paramfile.Write(out, outputFormat, loc)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return errors.Wrap(err, fs.Arg(1))
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"mandelbrot/fractal"
+	"mandelbrot/poster"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultPosterMemory = 512 // Memory used to render a strip, megabytes
+
+// posterCheckpoint is stored next to rendered strips, so an interrupted poster is resumed with the same options
+type posterCheckpoint struct {
+	Options     renderOptions `json:"options"`
+	StripHeight int           `json:"strip_height"`
+}
+
+// Read checkpoint of the strips directory or create it. Strip height of an existing checkpoint is kept,
+// so strips rendered before match the following ones
+func openPosterCheckpoint(dir string, opts renderOptions, stripHeight int) (int, error) {
+	path := filepath.Join(dir, "poster.json")
+
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		var stored posterCheckpoint
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return 0, errors.Wrap(err, path)
+		}
+
+		if !reflect.DeepEqual(stored.Options, opts) || stored.StripHeight <= 0 {
+			return 0, fmt.Errorf("checkpoint %s belongs to another poster, remove it or use -force", dir)
+		}
+
+		return stored.StripHeight, nil
+	}
+	if !os.IsNotExist(err) {
+		return 0, errors.Wrap(err, "read checkpoint")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, errors.Wrap(err, "create checkpoint directory")
+	}
+
+	data, err = json.MarshalIndent(posterCheckpoint{Options: opts, StripHeight: stripHeight}, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	return stripHeight, errors.Wrap(ioutil.WriteFile(path, data, 0644), "write checkpoint")
+}
+
+// Estimate relative cost of every poster row by iterations done for the preview rows.
+// Rows inside the set may take much longer than the rest, so the cost is used for ETA instead of rows
+func posterRowCosts(preview *fractal.Field, height int) []float64 {
+	previewCosts := make([]float64, preview.Height)
+	for y := range previewCosts {
+		// every pixel costs at least its coloring
+		previewCosts[y] = float64(preview.Width)
+		for x := 0; x < preview.Width; x++ {
+			previewCosts[y] += float64(preview.At(x, y).Iterations)
+		}
+	}
+
+	ret := make([]float64, height)
+	for y := range ret {
+		ret[y] = previewCosts[y*preview.Height/height]
+	}
+
+	return ret
+}
+
+// Stream strip files into a single PNG, only one strip is kept in memory
+func assemblePoster(output string, strips []string, width, height int) error {
+	tmpPath := output + ".part"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "create poster file")
+	}
+	defer f.Close()
+
+	buffered := bufio.NewWriterSize(f, 1<<20)
+	w, err := poster.NewPNGWriter(buffered, width, height)
+	if err != nil {
+		return err
+	}
+
+	for i, path := range strips {
+		strip, err := os.Open(path)
+		if err != nil {
+			return errors.Wrap(err, "open strip")
+		}
+
+		img, err := png.Decode(strip)
+		strip.Close()
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+
+		if err := w.WriteRows(img); err != nil {
+			return errors.Wrapf(err, "strip %d", i)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, output)
+}
+
+// poster subcommand: render image larger than memory in horizontal strips.
+// Strips are stored in the checkpoint directory, so an interrupted render resumes from the last strip
+func posterCommand(args []string) error {
+	fs := flag.NewFlagSet("poster", flag.ExitOnError)
+	output := fs.String("o", "poster.png", "output PNG file, strips are kept in <output>.parts until it is complete")
+	memory := fs.Int("memory", DefaultPosterMemory, "memory used to render a strip, megabytes")
+	force := fs.Bool("force", false, "drop strips rendered before and start over")
+	opts := newRenderOptions()
+	opts.register(fs)
+	_ = fs.Parse(args)
+
+	if imageFormat(*output) != "png" || *output == "-" {
+		return errors.New("poster output must be a .png file")
+	}
+
+	state, err := opts.State()
+	if err != nil {
+		return err
+	}
+
+	generator, colorizer, err := opts.build()
+	if err != nil {
+		return err
+	}
+
+	stripHeight := int(int64(*memory) << 20 / (int64(opts.Width) * opts.pixelMemory()))
+	if stripHeight < 1 {
+		stripHeight = 1
+	} else if stripHeight > opts.Height {
+		stripHeight = opts.Height
+	}
+
+	dir := *output + ".parts"
+	if *force {
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.Wrap(err, "remove checkpoint")
+		}
+	}
+	stripHeight, err = openPosterCheckpoint(dir, opts, stripHeight)
+	if err != nil {
+		return err
+	}
+
+	// mappings like histogram depend on all the values of the frame,
+	// colors of separate strips match only when the mapping is built once for the whole image
+	preview, err := previewState(state)
+	if err != nil {
+		return err
+	}
+	previewField := generateField(nil, generator, preview, colorizer.Options(), func(float32) {})
+	colorizer.Calibrate(previewField)
+	rowCosts := posterRowCosts(previewField, opts.Height)
+
+	strips := make([]string, (opts.Height+stripHeight-1)/stripHeight)
+	stripCosts := make([]float64, len(strips))
+	remainingRows, remainingCost := 0, 0.0
+	for i := range strips {
+		y, rows := i*stripHeight, stripRows(i, stripHeight, opts.Height)
+		for _, cost := range rowCosts[y : y+rows] {
+			stripCosts[i] += cost
+		}
+
+		strips[i] = filepath.Join(dir, fmt.Sprintf("strip_%05d.png", i))
+		if !imageComplete(strips[i], opts.Width, rows) {
+			remainingRows += rows
+			remainingCost += stripCosts[i]
+		}
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Rendering %dx%d in %d strips of %d rows, %d rows left\n",
+		opts.Width, opts.Height, len(strips), stripHeight, remainingRows)
+
+	started := time.Now()
+	renderedCost := 0.0
+	for i, path := range strips {
+		y, rows := i*stripHeight, stripRows(i, stripHeight, opts.Height)
+		if imageComplete(path, opts.Width, rows) {
+			continue
+		}
+
+		stripState, err := subviewState(state, image.Rect(0, y, opts.Width, y+rows))
+		if err != nil {
+			return err
+		}
+
+		stripStarted := time.Now()
+		img := renderImage(nil, generator, colorizer, stripState, func(float32) {})
+		if err := writeImage(path, img, "png", 0); err != nil {
+			return errors.Wrapf(err, "strip %d", i)
+		}
+
+		renderedCost += stripCosts[i]
+		elapsed := time.Since(started)
+		eta := time.Duration(float64(elapsed) / renderedCost * (remainingCost - renderedCost))
+		_, _ = fmt.Fprintf(os.Stderr, "[%d/%d] rows %d-%d in %s, %.1f%% done, ETA %s\n",
+			i+1, len(strips), y, y+rows-1, time.Since(stripStarted).Round(time.Millisecond),
+			100*renderedCost/remainingCost, eta.Round(time.Second))
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Writing %s\n", *output)
+	if err := assemblePoster(*output, strips, opts.Width, opts.Height); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrap(err, "remove checkpoint")
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Rendered %dx%d in %s\n", opts.Width, opts.Height, time.Since(started).Round(time.Millisecond))
+
+	return nil
+}
+
+// Number of rows of the strip, the last strip may be shorter
+func stripRows(index, stripHeight, height int) int {
+	if rows := height - index*stripHeight; rows < stripHeight {
+		return rows
+	}
+
+	return stripHeight
+}
@@ -0,0 +1,222 @@
+// Package poster writes images too large to be kept in memory as they are rendered part by part
+package poster
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Size of IDAT chunks, compressed data is split into chunks of this size
+const pngChunkSize = 1 << 16
+
+// PNGWriter encodes opaque RGB PNG image row by row, so only the rows being written are kept in memory
+type PNGWriter struct {
+	w             io.Writer
+	width, height int
+	rows          int // Rows written so far
+
+	chunks  *bufio.Writer // Splits compressed data into IDAT chunks
+	deflate *zlib.Writer
+
+	prev, cur []byte    // Previous and current raw rows
+	filtered  [5][]byte // Current row with every filter type applied, first byte is the filter type
+}
+
+// NewPNGWriter writes PNG header of the image size. Alpha channel is not stored
+func NewPNGWriter(w io.Writer, width, height int) (*PNGWriter, error) {
+	if width <= 0 || height <= 0 || width > 1<<30 || height > 1<<30 {
+		return nil, fmt.Errorf("invalid PNG size %dx%d", width, height)
+	}
+
+	ret := &PNGWriter{
+		w:      w,
+		width:  width,
+		height: height,
+		prev:   make([]byte, width*3),
+		cur:    make([]byte, width*3),
+	}
+	for i := range ret.filtered {
+		ret.filtered[i] = make([]byte, width*3+1)
+		ret.filtered[i][0] = byte(i)
+	}
+
+	if _, err := io.WriteString(w, "\x89PNG\r\n\x1a\n"); err != nil {
+		return nil, errors.Wrap(err, "write PNG signature")
+	}
+
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], uint32(width))
+	binary.BigEndian.PutUint32(header[4:], uint32(height))
+	header[8] = 8 // bit depth
+	header[9] = 2 // color type: RGB
+	if err := ret.writeChunk("IHDR", header); err != nil {
+		return nil, err
+	}
+
+	ret.chunks = bufio.NewWriterSize(chunkWriter{ret}, pngChunkSize)
+	ret.deflate = zlib.NewWriter(ret.chunks)
+
+	return ret, nil
+}
+
+func (p *PNGWriter) writeChunk(name string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], name)
+
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write(header[4:])
+	_, _ = crc.Write(data)
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, crc.Sum32())
+
+	for _, b := range [][]byte{header, data, footer} {
+		if _, err := p.w.Write(b); err != nil {
+			return errors.Wrapf(err, "write PNG %s chunk", name)
+		}
+	}
+
+	return nil
+}
+
+// chunkWriter writes every write as a separate IDAT chunk
+type chunkWriter struct {
+	p *PNGWriter
+}
+
+func (c chunkWriter) Write(data []byte) (int, error) {
+	if err := c.p.writeChunk("IDAT", data); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// Rows returns number of rows written so far
+func (p *PNGWriter) Rows() int {
+	return p.rows
+}
+
+// WriteRows appends all the rows of the image, image must be of the PNG width
+func (p *PNGWriter) WriteRows(img image.Image) error {
+	bounds := img.Bounds()
+	if bounds.Dx() != p.width {
+		return fmt.Errorf("rows of width %d expected, got %d", p.width, bounds.Dx())
+	}
+	if p.rows+bounds.Dy() > p.height {
+		return fmt.Errorf("too many rows: %d of %d", p.rows+bounds.Dy(), p.height)
+	}
+
+	rgba, _ := img.(*image.RGBA)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		if rgba != nil {
+			offset := rgba.PixOffset(bounds.Min.X, y)
+			src := rgba.Pix[offset : offset+p.width*4]
+			for x := 0; x < p.width; x++ {
+				copy(p.cur[x*3:x*3+3], src[x*4:x*4+3])
+			}
+		} else {
+			for x := 0; x < p.width; x++ {
+				r, g, b, _ := img.At(bounds.Min.X+x, y).RGBA()
+				p.cur[x*3], p.cur[x*3+1], p.cur[x*3+2] = uint8(r>>8), uint8(g>>8), uint8(b>>8)
+			}
+		}
+
+		if _, err := p.deflate.Write(p.filter()); err != nil {
+			return err
+		}
+
+		p.prev, p.cur = p.cur, p.prev
+		p.rows++
+	}
+
+	return nil
+}
+
+// Apply all the filter types to the current row and select the one that should compress best,
+// it is the one with minimal sum of absolute differences like in the standard encoder
+func (p *PNGWriter) filter() []byte {
+	const bpp = 3
+
+	none, sub, up, average, paeth := p.filtered[0][1:], p.filtered[1][1:], p.filtered[2][1:], p.filtered[3][1:], p.filtered[4][1:]
+	copy(none, p.cur)
+
+	for i := range p.cur {
+		var left, upLeft byte
+		if i >= bpp {
+			left, upLeft = p.cur[i-bpp], p.prev[i-bpp]
+		}
+		above := p.prev[i]
+
+		sub[i] = p.cur[i] - left
+		up[i] = p.cur[i] - above
+		average[i] = p.cur[i] - byte((int(left)+int(above))/2)
+		paeth[i] = p.cur[i] - paethPredictor(left, above, upLeft)
+	}
+
+	best, bestSum := 0, -1
+	for f := range p.filtered {
+		sum := 0
+		for _, b := range p.filtered[f][1:] {
+			sum += abs8(b)
+		}
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = f, sum
+		}
+	}
+
+	return p.filtered[best]
+}
+
+func abs8(b byte) int {
+	if b < 128 {
+		return int(b)
+	}
+
+	return 256 - int(b)
+}
+
+func paethPredictor(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := p-int(a), p-int(b), p-int(c)
+	if pa < 0 {
+		pa = -pa
+	}
+	if pb < 0 {
+		pb = -pb
+	}
+	if pc < 0 {
+		pc = -pc
+	}
+
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+
+	return c
+}
+
+// Close finishes the image, all the rows must be written. The underlying writer is not closed
+func (p *PNGWriter) Close() error {
+	if p.rows != p.height {
+		return fmt.Errorf("image is incomplete: %d of %d rows written", p.rows, p.height)
+	}
+
+	if err := p.deflate.Close(); err != nil {
+		return err
+	}
+	if err := p.chunks.Flush(); err != nil {
+		return err
+	}
+
+	return p.writeChunk("IEND", nil)
+}
@@ -0,0 +1,73 @@
+package poster
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestPNGWriter(t *testing.T) {
+	const width, height = 97, 61
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x * 3), G: uint8(y * 5), B: uint8(x * y), A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	w, err := NewPNGWriter(&buf, width, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rows come in strips of different heights
+	for _, strip := range []image.Rectangle{
+		image.Rect(0, 0, width, 10),
+		image.Rect(0, 10, width, 11),
+		image.Rect(0, 11, width, height),
+	} {
+		if err := w.WriteRows(img.SubImage(strip)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds() != img.Bounds() {
+		t.Fatalf("bounds %v, want %v", decoded.Bounds(), img.Bounds())
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if got := color.RGBAModel.Convert(decoded.At(x, y)); got != img.RGBAAt(x, y) {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, got, img.RGBAAt(x, y))
+			}
+		}
+	}
+}
+
+func TestPNGWriterIncomplete(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewPNGWriter(&buf, 4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteRows(image.NewRGBA(image.Rect(0, 0, 4, 5))); err == nil {
+		t.Error("too many rows are written")
+	}
+	if err := w.WriteRows(image.NewRGBA(image.Rect(0, 0, 3, 1))); err == nil {
+		t.Error("row of wrong width is written")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("incomplete image is closed")
+	}
+}
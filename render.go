@@ -0,0 +1,401 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mandelbrot/coloring"
+	"mandelbrot/fieldcache"
+	"mandelbrot/fractal"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultJPEGQuality = 90
+
+	// Pixels of the preview which colors of image parts rendered separately are calibrated by
+	previewPixels = 512 * 512
+)
+
+// Compute orbits of the state viewport. Blocks until the generator is done.
+// Cache is consulted first and the generated field is stored there, nil disables caching
+func generateField(
+	cache *fieldcache.Cache,
+	generator fractal.Generator,
+	state *State,
+	opts fractal.OrbitOptions,
+	reportingFunc fractal.ProgressReportingFunc,
+) *fractal.Field {
+	if rotator, ok := generator.(fractal.Rotator); ok {
+		rotator.SetRotation(state.GetRotation())
+	}
+
+	field := fractal.NewField(int(state.GetScreenWidth()), int(state.GetScreenHeight()))
+
+	key := ""
+	if cache != nil {
+		key = fieldCacheKey(generator, state, opts, field)
+		if key != "" && cache.Get(key, field) {
+			reportingFunc(1)
+			return field
+		}
+	}
+
+	done := make(chan struct{})
+	generator.Generate(
+		field,
+		state.GetCX(),
+		state.GetCY(),
+		state.GetScale(),
+		state.GetPhysicalWidth(),
+		state.GetPhysicalHeight(),
+		opts,
+		reportingFunc,
+		func() {
+			close(done)
+		},
+	)
+	<-done
+
+	storeCachedField(cache, key, generator, state, opts, field)
+
+	return field
+}
+
+// Render the state viewport into an image. No window or OpenGL context is needed
+func renderImage(
+	cache *fieldcache.Cache,
+	generator fractal.Generator,
+	colorizer *coloring.Colorizer,
+	state *State,
+	reportingFunc fractal.ProgressReportingFunc,
+) *image.RGBA {
+	field := generateField(cache, generator, state, colorizer.Options(), reportingFunc)
+
+	img := image.NewRGBA(image.Rect(0, 0, field.Width, field.Height))
+	colorizer.Colorize(field, img)
+
+	return img
+}
+
+// State of the rect part of the state view. Pixels of the part are exactly the pixels of the whole view
+func subviewState(state *State, rect image.Rectangle) (*State, error) {
+	width, height := state.GetScreenWidth(), state.GetScreenHeight()
+	prec := state.GetPrecision()
+
+	// part center is shifted from the view center by physWidth * (2x + w - width) / (2 width)
+	shift := func(center, physical *big.Float, min, size int, screen float64) *big.Float {
+		ret := big.NewFloat(float64(2*min + size - int(screen))).SetPrec(prec)
+		ret.Mul(ret, physical)
+		ret.Quo(ret, big.NewFloat(2*screen))
+		return ret.Add(ret, center)
+	}
+	cx := shift(state.GetCX(), state.GetPhysicalWidth(), rect.Min.X, rect.Dx(), width)
+	cy := shift(state.GetCY(), state.GetPhysicalHeight(), rect.Min.Y, rect.Dy(), height)
+
+	scale := big.NewFloat(float64(rect.Dy())).SetPrec(prec)
+	scale.Mul(scale, state.GetScale())
+	scale.Quo(scale, big.NewFloat(height))
+
+	return NewStateScale(cx, cy, scale, rect.Dx(), rect.Dy())
+}
+
+// State of the whole state view at a small size
+func previewState(state *State) (*State, error) {
+	width, height := state.GetScreenWidth(), state.GetScreenHeight()
+	k := math.Max(1, math.Sqrt(width*height/previewPixels))
+
+	return NewStateScale(state.GetCX(), state.GetCY(), state.GetScale(),
+		int(math.Max(1, math.Round(width/k))), int(math.Max(1, math.Round(height/k))))
+}
+
+// viewOptions select rendered location, image size and generator
+type viewOptions struct {
+	CX         string `json:"cx"`   // Center x-coordinate, decimal number of any precision
+	CY         string `json:"cy"`   // Center y-coordinate, decimal number of any precision
+	Zoom       string `json:"zoom"` // Magnification, 1 shows the whole set
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Generator  string `json:"generator"`
+	Iterations int    `json:"iterations"` // Iterations limit, 0 for default
+}
+
+func newViewOptions() viewOptions {
+	return viewOptions{
+		CX:        "-0.7",
+		CY:        "0",
+		Zoom:      "1",
+		Width:     int(DefaultScreenWidth),
+		Height:    int(DefaultScreenHeight),
+		Generator: "float64",
+	}
+}
+
+// Register options in the flag set, current values are used as defaults
+func (o *viewOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.CX, "cx", o.CX, "center x-coordinate, decimal number of any precision")
+	fs.StringVar(&o.CY, "cy", o.CY, "center y-coordinate, decimal number of any precision")
+	fs.StringVar(&o.Zoom, "zoom", o.Zoom, "magnification, 1 shows the whole set")
+	fs.IntVar(&o.Width, "width", o.Width, "image width in pixels")
+	fs.IntVar(&o.Height, "height", o.Height, "image height in pixels")
+	fs.StringVar(&o.Generator, "generator", o.Generator, "select generator: big or float64")
+	fs.IntVar(&o.Iterations, "iterations", o.Iterations, "iterations limit, 0 for default")
+}
+
+// State returns state of the selected view
+func (o *viewOptions) State() (*State, error) {
+	return NewStateView(o.CX, o.CY, o.Zoom, o.Width, o.Height)
+}
+
+// renderOptions are all options needed to render an image
+type renderOptions struct {
+	viewOptions
+	colorOptions
+}
+
+func newRenderOptions() renderOptions {
+	return renderOptions{
+		viewOptions:  newViewOptions(),
+		colorOptions: newColorOptions(),
+	}
+}
+
+func (o *renderOptions) register(fs *flag.FlagSet) {
+	o.viewOptions.register(fs)
+	o.colorOptions.register(fs)
+}
+
+// Create generator and colorizer of the selected options
+func (o *renderOptions) build() (fractal.Generator, *coloring.Colorizer, error) {
+	generator, err := newGenerator(o.Generator, o.Iterations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gradient, err := o.BuildGradient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pal, err := o.BuildPalette(gradient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	colorizer, err := o.BuildColorizer(pal)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return generator, colorizer, nil
+}
+
+// Estimate memory used per pixel while rendering: the orbit, the RGBA image,
+// palette positions and coloring values of the colorizer and of every layer
+// and the image the layers are colorized into
+func (o *renderOptions) pixelMemory() int64 {
+	ret := int64(unsafe.Sizeof(fractal.Orbit{})) + 4 + int64(len(o.Layers)+1)*(4+4)
+	if len(o.Layers) > 0 {
+		ret += 4
+	}
+
+	return ret
+}
+
+// Render image of the selected view, nil cache disables caching
+func (o *renderOptions) Render(cache *fieldcache.Cache, reportingFunc fractal.ProgressReportingFunc) (*image.RGBA, error) {
+	state, err := o.State()
+	if err != nil {
+		return nil, err
+	}
+
+	generator, colorizer, err := o.build()
+	if err != nil {
+		return nil, err
+	}
+
+	return renderImage(cache, generator, colorizer, state, reportingFunc), nil
+}
+
+// Render location of another explorer file, its iterations limit is used unless the options select one
+func renderImported(
+	opts *renderOptions,
+	path, entry string,
+	cache *fieldcache.Cache,
+	reportingFunc fractal.ProgressReportingFunc,
+) (*image.RGBA, error) {
+	state, iterations, err := importState(path, entry, opts.Width, opts.Height)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Iterations == 0 {
+		opts.Iterations = iterations
+	}
+
+	generator, colorizer, err := opts.build()
+	if err != nil {
+		return nil, err
+	}
+
+	return renderImage(cache, generator, colorizer, state, reportingFunc), nil
+}
+
+// Select image format by the file extension, PNG is used by default
+func imageFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	default:
+		return "png"
+	}
+}
+
+// Encode image as png or jpeg
+func encodeImage(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case "png":
+		return png.Encode(w, img)
+	case "jpeg", "jpg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	default:
+		return fmt.Errorf("unknown image format: %s", format)
+	}
+}
+
+// Write image to file, "-" writes to stdout. Empty format is selected by the file extension
+func writeImage(path string, img image.Image, format string, quality int) error {
+	if format == "" {
+		format = imageFormat(path)
+	}
+
+	if path == "-" {
+		return encodeImage(os.Stdout, img, format, quality)
+	}
+
+	// the image is written to a temporary file first, so an existing file is always complete
+	tmpPath := path + ".part"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "create image file")
+	}
+
+	err = encodeImage(f, img, format, quality)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, path)
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// Write file through a temporary file creating its directory, so readers never get a partial file.
+// The temporary name is unique, so concurrent writers don't mix their data
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmpPath := fmt.Sprintf("%s.%d.part", path, time.Now().UnixNano())
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// Check that the file is an image of the given size.
+// Images are written through a temporary file, so truncated files are not expected
+func imageComplete(path string, width, height int) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return false
+	}
+
+	return config.Width == width && config.Height == height
+}
+
+// Progress reporting function printing percents to stderr at most every 200ms
+func progressPrinter(prefix string) fractal.ProgressReportingFunc {
+	var mu sync.Mutex
+	lastPrinted := time.Now()
+
+	return func(progress float32) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if time.Since(lastPrinted) > time.Millisecond*200 {
+			lastPrinted = time.Now()
+			_, _ = fmt.Fprintf(os.Stderr, "%s: %3.0f%%\n", prefix, progress*100)
+		}
+	}
+}
+
+// render subcommand: render single image without a window
+func renderCommand(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	output := fs.String("o", "-", "output file, - for stdout")
+	format := fs.String("format", "", "output format: png or jpeg, selected by the output file extension if empty")
+	quality := fs.Int("quality", DefaultJPEGQuality, "JPEG quality, 1-100")
+	quiet := fs.Bool("quiet", false, "do not report progress to stderr")
+	importPath := fs.String("import", "", "render location of a Kalles Fraktaler .kfr, Fractint .par or XaoS .xpf file instead of cx, cy and zoom")
+	entry := fs.String("entry", "", "entry of the imported Fractint parameter file, the first Mandelbrot entry if empty")
+	opts := newRenderOptions()
+	opts.register(fs)
+	cacheOpts := newCacheOptions(0)
+	cacheOpts.register(fs)
+	_ = fs.Parse(args)
+
+	cache, err := cacheOpts.open()
+	if err != nil {
+		return err
+	}
+
+	progress := func(float32) {}
+	if !*quiet {
+		progress = progressPrinter("rendering")
+	}
+
+	started := time.Now()
+	var img *image.RGBA
+	if *importPath != "" {
+		img, err = renderImported(&opts, *importPath, *entry, cache, progress)
+	} else {
+		img, err = opts.Render(cache, progress)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeImage(*output, img, *format, *quality); err != nil {
+		return err
+	}
+
+	if !*quiet {
+		_, _ = fmt.Fprintf(os.Stderr, "Rendered %dx%d in %s\n", opts.Width, opts.Height, time.Since(started))
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+#shader vertex
+#version 330 core
+
+layout(location=0) in vec4 position;
+layout(location=1) in vec2 texCoord;
+
+out vec2 v_TexCoord;
+
+uniform mat4 u_MVP; // model-view-projection matrix
+uniform vec2 coords;
+
+void main() {
+    // setup vertex position
+    gl_Position = u_MVP * (position + vec4(coords, 0, 0));
+
+    // pass texture coordinates to fragment shader
+    v_TexCoord = texCoord;
+}
+
+#shader fragment
+#version 330 core
+
+layout(location=0) out vec4 color;
+
+in vec2 v_TexCoord;
+
+uniform sampler2D u_Texture; // palette positions of pixels, negative for points inside the set
+uniform sampler1D u_Palette;
+
+uniform float u_Offset;      // palette offset, used for palette cycling
+uniform float u_Density;     // how many times the palette repeats over positions range
+uniform int u_Mode;          // 0 - clamp, 1 - repeat, 2 - mirror
+uniform vec4 u_InsideColor;  // color of points inside the set
+
+void main() {
+    float position = texture(u_Texture, v_TexCoord).r;
+    if (position < 0.0) {
+        color = u_InsideColor;
+        return;
+    }
+
+    float t = position * u_Density + u_Offset;
+    if (u_Mode == 1) {
+        t = fract(t);
+    } else if (u_Mode == 2) {
+        t = 1.0 - abs(mod(t, 2.0) - 1.0);
+    } else {
+        t = clamp(t, 0.0, 1.0);
+    }
+
+    color = texture(u_Palette, t);
+}
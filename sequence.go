@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultFramesPerDoubling = 30
+
+// zoomPath is an exponential zoom from one view into another.
+// Magnification grows by the same ratio every frame and the end view center
+// keeps its position on the screen, so the camera flies straight into it
+type zoomPath struct {
+	from, to  *State
+	doublings float64 // Binary logarithm of the magnification ratio
+}
+
+func newZoomPath(from, to *State) *zoomPath {
+	return &zoomPath{
+		from:      from,
+		to:        to,
+		doublings: log2Big(from.GetScale()) - log2Big(to.GetScale()),
+	}
+}
+
+// Frames returns number of frames including the first and the last one
+func (p *zoomPath) Frames(framesPerDoubling float64) int {
+	return int(math.Max(1, math.Round(math.Abs(p.doublings)*framesPerDoubling))) + 1
+}
+
+// At returns the view at progress t in range [0, 1]
+func (p *zoomPath) At(t float64) *State {
+	scale := mulExp2Big(p.from.GetScale(), -p.doublings*t)
+
+	// fraction of the remaining scale change, the center moves proportionally to it
+	remaining := 1 - t
+	if math.Abs(p.doublings) > 1e-9 {
+		remaining = (math.Exp2(-p.doublings*t) - math.Exp2(-p.doublings)) / (1 - math.Exp2(-p.doublings))
+	}
+
+	cx := lerpBig(p.to.GetCX(), p.from.GetCX(), remaining)
+	cy := lerpBig(p.to.GetCY(), p.from.GetCY(), remaining)
+
+	ret, _ := NewStateScale(cx, cy, scale, int(p.to.GetScreenWidth()), int(p.to.GetScreenHeight()))
+
+	return ret
+}
+
+// zoom subcommand: render zoom animation into a target location as numbered image files
+func zoomCommand(args []string) error {
+	fs := flag.NewFlagSet("zoom", flag.ExitOnError)
+	fromCX := fs.String("from-cx", "-0.7", "center x-coordinate of the first frame")
+	fromCY := fs.String("from-cy", "0", "center y-coordinate of the first frame")
+	fromZoom := fs.String("from-zoom", "1", "magnification of the first frame")
+	framesPerDoubling := fs.Float64("fpd", DefaultFramesPerDoubling, "frames per doubling of magnification")
+	frames := fs.Int("frames", 0, "number of frames, 0 to calculate it from -fpd")
+	easingStr := fs.String("ease", "none", "zoom speed easing: none, in, out or inout")
+	frameOpts := newFrameOptions()
+	frameOpts.register(fs)
+	opts := newRenderOptions()
+	opts.register(fs)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: %s zoom [options]\n"+
+			"Zooms from -from-cx, -from-cy, -from-zoom into -cx, -cy, -zoom\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	easing, err := parseEasing(*easingStr)
+	if err != nil {
+		return err
+	}
+
+	from, err := NewStateView(*fromCX, *fromCY, *fromZoom, opts.Width, opts.Height)
+	if err != nil {
+		return err
+	}
+
+	to, err := opts.State()
+	if err != nil {
+		return err
+	}
+
+	generator, colorizer, err := opts.build()
+	if err != nil {
+		return err
+	}
+
+	path := newZoomPath(from, to)
+	if *frames <= 0 {
+		*frames = path.Frames(*framesPerDoubling)
+	}
+	if *frames < 2 {
+		return errors.New("at least 2 frames expected")
+	}
+
+	return frameOpts.writeFrames(opts.Width, opts.Height, *frames, func(frame int) (*image.RGBA, error) {
+		state := path.At(easing(float64(frame) / float64(*frames-1)))
+		return renderImage(nil, generator, colorizer, state, func(float32) {}), nil
+	})
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mandelbrot/fieldcache"
+	"mandelbrot/fractal"
+	"mandelbrot/palette"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultServeMaxPixels     = 4096 * 4096
+	DefaultServeMaxIterations = 100000
+	DefaultServeTimeout       = 60 * time.Second
+
+	serveMaxPaletteSize = 1 << 16
+	serveMaxLayers      = 8
+	serveMaxParamLength = 4096
+)
+
+// Short names of query parameters
+var renderParamAliases = map[string]string{
+	"w": "width",
+	"h": "height",
+}
+
+// serveLimits restrict requests, so a single request can not take the whole server
+type serveLimits struct {
+	MaxPixels     int     `json:"max_pixels"`
+	MaxIterations int     `json:"max_iterations"`
+	TimeoutSec    float64 `json:"timeout_seconds"`
+}
+
+// renderServer renders images requested by query parameters named like the render subcommand flags
+type renderServer struct {
+	// counters are updated atomically, 64-bit ones go first to be aligned on 32-bit platforms
+	rendered, failed, canceled, rejected int64
+	waiting, rendering                   int32
+
+	limits  serveLimits
+	timeout time.Duration
+	workers chan struct{}
+	started time.Time
+	cache   *fieldcache.Cache // Nil when caching is disabled
+}
+
+// serveRequest is a parsed render request
+type serveRequest struct {
+	renderOptions
+	Format  string
+	Quality int
+}
+
+// Parse query parameters. Every parameter is a flag of the render subcommand, so values are checked the same way
+func parseServeRequest(query map[string][]string) (*serveRequest, error) {
+	req := &serveRequest{renderOptions: newRenderOptions()}
+
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.StringVar(&req.Format, "format", "png", "")
+	fs.IntVar(&req.Quality, "quality", DefaultJPEGQuality, "")
+	req.register(fs)
+
+	for name, values := range query {
+		if alias, ok := renderParamAliases[name]; ok {
+			name = alias
+		}
+
+		f := fs.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown parameter: %s", name)
+		}
+
+		for _, value := range values {
+			if len(value) > serveMaxParamLength {
+				return nil, fmt.Errorf("parameter %s is too long", name)
+			}
+
+			// ?lighting enables boolean option like the flag without value
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && value == "" {
+				value = "true"
+			}
+
+			if err := fs.Set(name, value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", name, err)
+			}
+		}
+	}
+
+	if req.Format == "jpg" {
+		req.Format = "jpeg"
+	}
+	if req.Format != "png" && req.Format != "jpeg" {
+		return nil, fmt.Errorf("unknown format: %s", req.Format)
+	}
+	if req.Quality < 1 || req.Quality > 100 {
+		return nil, errors.New("quality must be in range 1-100")
+	}
+
+	return req, nil
+}
+
+// Check request against the limits. Palettes are limited to built-in ones, files must not be read from the server disk
+func (s *renderServer) check(req *serveRequest) error {
+	if req.Width <= 0 || req.Height <= 0 {
+		return fmt.Errorf("invalid size %dx%d", req.Width, req.Height)
+	}
+	if int64(req.Width)*int64(req.Height) > int64(s.limits.MaxPixels) {
+		return fmt.Errorf("image of %dx%d is larger than %d pixels", req.Width, req.Height, s.limits.MaxPixels)
+	}
+	if req.Iterations > s.limits.MaxIterations {
+		return fmt.Errorf("iterations limit is %d", s.limits.MaxIterations)
+	}
+	if req.PaletteSize <= 0 || req.PaletteSize > serveMaxPaletteSize {
+		return fmt.Errorf("palette size must be in range 1-%d", serveMaxPaletteSize)
+	}
+	if len(req.Layers) > serveMaxLayers {
+		return fmt.Errorf("at most %d layers are allowed", serveMaxLayers)
+	}
+	if req.Extract != "" {
+		return errors.New("palette extraction is not allowed")
+	}
+
+	palettes := []string{req.Palette}
+	for _, spec := range req.Layers {
+		for _, item := range strings.Split(spec, ",") {
+			if strings.HasPrefix(item, "palette=") {
+				palettes = append(palettes, strings.TrimPrefix(item, "palette="))
+			}
+		}
+	}
+	for _, name := range palettes {
+		if name == "" {
+			continue
+		}
+		if _, err := palette.GetBuiltin(name); err != nil {
+			return fmt.Errorf("unknown built-in palette: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// Render the request, rendering stops when the context is done
+func (s *renderServer) render(ctx context.Context, req *serveRequest) ([]byte, error) {
+	state, err := req.State()
+	if err != nil {
+		return nil, err
+	}
+
+	generator, colorizer, err := req.build()
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := generator.(fractal.Canceler); ok {
+		c.SetCancel(ctx.Done())
+	}
+
+	// wait for a free worker, the time limit includes waiting
+	atomic.AddInt32(&s.waiting, 1)
+	select {
+	case s.workers <- struct{}{}:
+		atomic.AddInt32(&s.waiting, -1)
+	case <-ctx.Done():
+		atomic.AddInt32(&s.waiting, -1)
+		return nil, ctx.Err()
+	}
+	atomic.AddInt32(&s.rendering, 1)
+	img := renderImage(s.cache, generator, colorizer, state, func(float32) {})
+	atomic.AddInt32(&s.rendering, -1)
+	<-s.workers
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, img, req.Format, req.Quality); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *renderServer) handleRender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := parseServeRequest(r.URL.Query())
+	if err == nil {
+		err = s.check(req)
+	}
+	if err != nil {
+		atomic.AddInt64(&s.rejected, 1)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	started := time.Now()
+	data, err := s.render(ctx, req)
+	switch {
+	case r.Context().Err() != nil:
+		// client is gone, nobody gets the response
+		atomic.AddInt64(&s.canceled, 1)
+		return
+	case err == context.DeadlineExceeded:
+		atomic.AddInt64(&s.canceled, 1)
+		http.Error(w, fmt.Sprintf("render time limit of %s exceeded", s.timeout), http.StatusGatewayTimeout)
+		return
+	case err != nil:
+		// options are checked by parsing, so remaining errors are invalid values like unknown names
+		atomic.AddInt64(&s.failed, 1)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	atomic.AddInt64(&s.rendered, 1)
+	log.Printf("%s %dx%d in %s", r.URL.RawQuery, req.Width, req.Height, time.Since(started).Round(time.Millisecond))
+
+	w.Header().Set("Content-Type", "image/"+req.Format)
+	_, _ = w.Write(data)
+}
+
+// serveStatus is the health endpoint response
+type serveStatus struct {
+	Status        string      `json:"status"`
+	UptimeSec     float64     `json:"uptime_seconds"`
+	Workers       int         `json:"workers"`
+	Rendering     int32       `json:"rendering"`
+	Waiting       int32       `json:"waiting"`
+	Rendered      int64       `json:"rendered"`
+	Failed        int64       `json:"failed"`
+	Canceled      int64       `json:"canceled"`
+	Rejected      int64       `json:"rejected"`
+	Limits        serveLimits `json:"limits"`
+	NumGoroutines int         `json:"goroutines"`
+}
+
+func (s *renderServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	data, err := json.MarshalIndent(serveStatus{
+		Status:        "ok",
+		UptimeSec:     time.Since(s.started).Seconds(),
+		Workers:       cap(s.workers),
+		Rendering:     atomic.LoadInt32(&s.rendering),
+		Waiting:       atomic.LoadInt32(&s.waiting),
+		Rendered:      atomic.LoadInt64(&s.rendered),
+		Failed:        atomic.LoadInt64(&s.failed),
+		Canceled:      atomic.LoadInt64(&s.canceled),
+		Rejected:      atomic.LoadInt64(&s.rejected),
+		Limits:        s.limits,
+		NumGoroutines: runtime.NumGoroutine(),
+	}, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// serve subcommand: HTTP API rendering images for queries like /render?cx=-0.75&cy=0.1&zoom=20&w=800&h=600
+func serveCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8081", "listen address")
+	workers := fs.Int("workers", runtime.NumCPU()/4+1, "maximum number of images rendered at once, every image uses all CPUs")
+	maxPixels := fs.Int("max-pixels", DefaultServeMaxPixels, "maximum number of pixels of an image")
+	maxIterations := fs.Int("max-iterations", DefaultServeMaxIterations, "maximum iterations limit of a request")
+	timeout := fs.Duration("timeout", DefaultServeTimeout, "render time limit of a request including waiting for a worker")
+	cacheOpts := newCacheOptions(0)
+	cacheOpts.register(fs)
+	_ = fs.Parse(args)
+
+	if *workers < 1 || *maxPixels < 1 || *maxIterations < 1 || *timeout <= 0 {
+		return errors.New("workers, limits and timeout must be positive")
+	}
+
+	cache, err := cacheOpts.open()
+	if err != nil {
+		return err
+	}
+
+	server := &renderServer{
+		limits: serveLimits{
+			MaxPixels:     *maxPixels,
+			MaxIterations: *maxIterations,
+			TimeoutSec:    timeout.Seconds(),
+		},
+		timeout: *timeout,
+		workers: make(chan struct{}, *workers),
+		started: time.Now(),
+		cache:   cache,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/render", server.handleRender)
+	mux.HandleFunc("/health", server.handleHealth)
+
+	log.Printf("Serving render API at http://%s/render, status at /health", *addr)
+
+	return http.ListenAndServe(*addr, mux)
+}
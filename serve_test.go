@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRenderServer(timeout time.Duration) *renderServer {
+	return &renderServer{
+		limits: serveLimits{
+			MaxPixels:     64 * 64,
+			MaxIterations: 1000,
+			TimeoutSec:    timeout.Seconds(),
+		},
+		timeout: timeout,
+		workers: make(chan struct{}, 1),
+		started: time.Now(),
+	}
+}
+
+func TestParseServeRequest(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"w=32&h=16&zoom=2&format=jpg", ""},
+		{"lighting&palette=viridis", ""},
+		{"size=32", "unknown parameter: size"},
+		{"width=x", "invalid width"},
+		{"format=gif", "unknown format: gif"},
+		{"quality=0", "quality must be in range 1-100"},
+		{"cx=" + strings.Repeat("1", serveMaxParamLength+1), "parameter cx is too long"},
+	}
+
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := parseServeRequest(query)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.query, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error %q expected, got %v", test.query, test.err, err)
+		}
+		if req != nil {
+			t.Errorf("%s: request returned with an error", test.query)
+		}
+	}
+
+	req, err := parseServeRequest(url.Values{"w": {"32"}, "h": {"16"}, "format": {"jpg"}, "lighting": {""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Width != 32 || req.Height != 16 || req.Format != "jpeg" || !req.Lighting {
+		t.Errorf("parameters are not applied: %dx%d, format %s, lighting %t", req.Width, req.Height, req.Format, req.Lighting)
+	}
+}
+
+func TestRenderServerCheck(t *testing.T) {
+	server := newTestRenderServer(time.Second)
+
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"w=64&h=64&iterations=1000&palette=viridis", ""},
+		{"w=64&h=65", "larger than 4096 pixels"},
+		{"w=0&h=64", "invalid size"},
+		{"w=64&h=64&iterations=1001", "iterations limit is 1000"},
+		{"w=64&h=64&palette-size=0", "palette size must be in range"},
+		{"w=64&h=64&palette-size=65537", "palette size must be in range"},
+		{"w=64&h=64&palette=/etc/palette.map", "unknown built-in palette"},
+		{"w=64&h=64&layer=coloring=stripe,palette=palette.ggr", "unknown built-in palette"},
+		{"w=64&h=64&extract-palette=image.png", "palette extraction is not allowed"},
+	}
+
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := parseServeRequest(query)
+		if err != nil {
+			t.Fatalf("%s: %v", test.query, err)
+		}
+
+		err = server.check(req)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.query, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error %q expected, got %v", test.query, test.err, err)
+		}
+	}
+}
+
+func TestServeRender(t *testing.T) {
+	server := newTestRenderServer(time.Minute)
+
+	w := httptest.NewRecorder()
+	server.handleRender(w, httptest.NewRequest(http.MethodGet, "/render?w=32&h=16&iterations=100", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("got %d %s: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.handleRender(w, httptest.NewRequest(http.MethodGet, "/render?size=32", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown parameter: got %d, expected %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServeTimeout(t *testing.T) {
+	server := newTestRenderServer(50 * time.Millisecond)
+
+	// the only worker is busy, so the request times out waiting for it
+	server.workers <- struct{}{}
+	defer func() { <-server.workers }()
+
+	w := httptest.NewRecorder()
+	server.handleRender(w, httptest.NewRequest(http.MethodGet, "/render?w=32&h=16&iterations=100", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("got %d, expected %d: %s", w.Code, http.StatusGatewayTimeout, w.Body.String())
+	}
+	if server.canceled != 1 {
+		t.Errorf("%d canceled requests counted, expected 1", server.canceled)
+	}
+}
+
+func TestServeHealth(t *testing.T) {
+	server := newTestRenderServer(time.Second)
+
+	w := httptest.NewRecorder()
+	server.handleRender(w, httptest.NewRequest(http.MethodGet, "/render?w=0", nil))
+
+	w = httptest.NewRecorder()
+	server.handleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var status map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{
+		"status", "uptime_seconds", "workers", "rendering", "waiting",
+		"rendered", "failed", "canceled", "rejected", "limits", "goroutines",
+	} {
+		if _, ok := status[key]; !ok {
+			t.Errorf("%s is missing", key)
+		}
+	}
+	if status["status"] != "ok" || status["workers"] != 1.0 || status["rejected"] != 1.0 {
+		t.Errorf("unexpected status: %v", status)
+	}
+
+	limits, _ := status["limits"].(map[string]interface{})
+	if limits["max_pixels"] != 4096.0 || limits["max_iterations"] != 1000.0 || limits["timeout_seconds"] != 1.0 {
+		t.Errorf("unexpected limits: %v", status["limits"])
+	}
+}
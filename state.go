@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"math/big"
 )
 
@@ -11,6 +12,7 @@ type State struct {
 	scale                         *big.Float // Scale ratio
 	screenWidth, screenHeight     float64    // Screen width and height in pixels
 	physicalWidth, physicalHeight *big.Float // Physical coordinates that is currently rendered
+	rotation                      float64    // Counterclockwise view rotation around the center, radians
 }
 
 const (
@@ -52,6 +54,7 @@ func (s *State) Copy() *State {
 	ret.screenWidth, ret.screenHeight = s.screenWidth, s.screenHeight
 	ret.physicalWidth = big.NewFloat(0).Copy(s.physicalWidth)
 	ret.physicalHeight = big.NewFloat(0).Copy(s.physicalHeight)
+	ret.rotation = s.rotation
 
 	return ret
 }
@@ -63,6 +66,7 @@ func (s *State) String() string {
 		fmt.Sprintf(" scale=%.50f\n", s.scale) +
 		fmt.Sprintf(" physWidth=%.50f\n", s.physicalWidth) +
 		fmt.Sprintf(" physHeight=%.50f\n", s.physicalHeight) +
+		fmt.Sprintf(" rotation=%f\n", s.rotation) +
 		")"
 }
 
@@ -113,3 +117,79 @@ func (s *State) GetPhysicalWidth() *big.Float {
 func (s *State) GetPhysicalHeight() *big.Float {
 	return s.physicalHeight
 }
+
+// Return view rotation in radians
+func (s *State) GetRotation() float64 {
+	return s.rotation
+}
+
+// Rotate view counterclockwise around the center, angle is in radians
+func (s *State) SetRotation(angle float64) {
+	s.rotation = angle
+}
+
+// NewStateView creates state of the view centered at cx, cy with the given magnification.
+// Coordinates are decimal strings parsed without losing precision, pixels of the screen are square
+func NewStateView(cx, cy, zoom string, width, height int) (*State, error) {
+	values := make([]*big.Float, 3)
+	precision := uint(DefaultFloatsPrecision)
+	for i, v := range []struct {
+		name string
+		s    string
+	}{
+		{"cx", cx},
+		{"cy", cy},
+		{"zoom", zoom},
+	} {
+		// every decimal digit needs log2(10) bits, so long coordinates keep all their digits
+		prec := uint(DefaultFloatsPrecision)
+		if bits := uint(float64(len(v.s)) * math.Log2(10)); bits > prec {
+			prec = bits
+		}
+
+		f, _, err := big.ParseFloat(v.s, 10, prec, big.ToNearestEven)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", v.name, v.s, err)
+		}
+		values[i] = f
+		if prec > precision {
+			precision = prec
+		}
+	}
+
+	if values[2].Sign() <= 0 {
+		return nil, fmt.Errorf("zoom must be positive: %s", zoom)
+	}
+
+	// scale is the inverse of magnification
+	scale := big.NewFloat(1).SetPrec(precision)
+	scale.Quo(scale, values[2])
+
+	return NewStateScale(values[0], values[1], scale, width, height)
+}
+
+// NewStateScale creates state of the view centered at cx, cy with the given scale and square pixels.
+// Precision is raised when the values are more precise than the default one
+func NewStateScale(cx, cy, scale *big.Float, width, height int) (*State, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid size %dx%d", width, height)
+	}
+
+	ret := NewState()
+	for _, v := range []*big.Float{cx, cy, scale} {
+		if v.Prec() > ret.precision {
+			ret.SetPrecision(v.Prec())
+		}
+	}
+	ret.cx.Set(cx)
+	ret.cy.Set(cy)
+	ret.scale.Set(scale)
+
+	ret.screenWidth, ret.screenHeight = float64(width), float64(height)
+
+	ret.physicalHeight = big.NewFloat(DefaultPhysicalHeight).SetPrec(ret.precision)
+	ret.physicalHeight.Mul(ret.physicalHeight, ret.scale)
+	ret.physicalWidth = big.NewFloat(0).SetPrec(ret.precision).Mul(ret.physicalHeight, big.NewFloat(float64(width)/float64(height)))
+
+	return ret, nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"mandelbrot/coloring"
+	"mandelbrot/fractal"
+	"mandelbrot/fractal/mandelbrot"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultTileSize    = 256
+	DefaultTileMaxZoom = 60
+	DefaultTileQueue   = 256 // Tiles rendered or waiting for a worker at once
+
+	// Deepest zoom level where float64 still resolves tile pixels, deeper tiles are rendered by the big generator
+	float64TileMaxZoom = 40
+
+	// Iterations limit grows by this share of the base limit on every zoom level,
+	// details of deeper levels need more iterations to show up
+	tileIterationsPerLevel = 0.25
+)
+
+var errTilesBusy = errors.New("too many tiles are requested")
+
+// Tile path in the layout of slippy maps like Leaflet and OpenLayers expect
+var tilePathRegexp = regexp.MustCompile(`^/(\d+)/(\d+)/(\d+)\.png$`)
+
+// tileKey identifies a tile. Coordinates are decimal, so they fit at any zoom level
+type tileKey struct {
+	z    int
+	x, y string
+}
+
+// tileLevel is a colorizer of a zoom level, calibrated once when the first tile of the level is rendered
+type tileLevel struct {
+	once      sync.Once
+	colorizer *coloring.Colorizer
+	err       error
+}
+
+// tileCall is a tile rendered once for all the requests waiting for it
+type tileCall struct {
+	done      chan struct{} // Closed when the tile is rendered
+	abandoned chan struct{} // Closed when all the requests are gone before rendering started
+	waiters   int
+	started   bool
+	data      []byte
+	err       error
+}
+
+// tileServer serves PNG tiles of the set. Rendered tiles are kept in the disk cache,
+// at most workers tiles are rendered at once
+type tileServer struct {
+	opts     renderOptions
+	size     int
+	maxZoom  int
+	cacheDir string // Cache of the render options, empty to disable caching
+
+	workers chan struct{}
+	queue   int
+
+	mu     sync.Mutex
+	calls  map[tileKey]*tileCall
+	levels map[int]*tileLevel
+}
+
+func newTileServer(opts renderOptions, size, maxZoom int, cacheDir string, workers, queue int) (*tileServer, error) {
+	if _, _, err := opts.build(); err != nil {
+		return nil, err
+	}
+
+	ret := &tileServer{
+		opts:    opts,
+		size:    size,
+		maxZoom: maxZoom,
+		workers: make(chan struct{}, workers),
+		queue:   queue,
+		calls:   map[tileKey]*tileCall{},
+		levels:  map[int]*tileLevel{},
+	}
+
+	// tiles are cached per render options, so changed options never serve stale tiles
+	if cacheDir != "" {
+		data, err := json.Marshal(opts)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256(data)
+		ret.cacheDir = filepath.Join(cacheDir, hex.EncodeToString(hash[:8]))
+	}
+
+	return ret, nil
+}
+
+// Iterations limit of tiles at the zoom level
+func tileIterations(iterations, z int) int {
+	if iterations <= 0 {
+		iterations = mandelbrot.DefaultIterations
+	}
+
+	return int(float64(iterations) * (1 + tileIterationsPerLevel*float64(z)))
+}
+
+// Get colorizer of the zoom level. Neighbour tiles must get matching colors, so mappings like histogram
+// are built once by the whole set rendered with the iterations limit of the level. Deep levels show
+// a tiny part of the set, so such mappings get flat there: tiles take few colors of the whole set mapping
+func (s *tileServer) levelColorizer(z int) (*coloring.Colorizer, error) {
+	s.mu.Lock()
+	level, ok := s.levels[z]
+	if !ok {
+		level = &tileLevel{}
+		s.levels[z] = level
+	}
+	s.mu.Unlock()
+
+	level.once.Do(func() {
+		_, level.colorizer, level.err = s.opts.build()
+		if level.err != nil {
+			return
+		}
+
+		var world *State
+		world, level.err = tileState(0, big.NewInt(0), big.NewInt(0), s.size)
+		if level.err != nil {
+			return
+		}
+
+		var generator fractal.Generator
+		generator, level.err = newGenerator(s.opts.Generator, tileIterations(s.opts.Iterations, z))
+		if level.err != nil {
+			return
+		}
+
+		level.colorizer.Calibrate(generateField(nil, generator, world, level.colorizer.Options(), func(float32) {}))
+	})
+
+	return level.colorizer, level.err
+}
+
+// State of the tile. Zoom level 0 is a single tile covering the square from -2.5-2i to 1.5+2i,
+// every next level splits tiles in four. Coordinates of tiles are exact at any level.
+// Imaginary part grows down like rows of all the rendered images
+func tileState(z int, x, y *big.Int, size int) (*State, error) {
+	prec := uint(z) + 64
+
+	// tile side is 2^(2-z), tile center is at the corner of the square plus (2x+1) halves of the side
+	half := big.NewFloat(1).SetPrec(prec)
+	half.SetMantExp(half, 1-z)
+
+	center := func(index *big.Int, corner float64) *big.Float {
+		ret := big.NewFloat(0).SetPrec(prec).SetInt(index)
+		ret.Mul(ret, big.NewFloat(2))
+		ret.Add(ret, big.NewFloat(1))
+		ret.Mul(ret, half)
+		return ret.Add(ret, big.NewFloat(corner))
+	}
+
+	// physical height of a state is twice its scale, so the scale is a half of the tile side
+	ret, err := NewStateScale(center(x, -2.5), center(y, -2), half, size, size)
+	if err != nil {
+		return nil, err
+	}
+	ret.SetPrecision(prec)
+
+	return ret, nil
+}
+
+// Parse tile path and check that the tile exists
+func (s *tileServer) parseTile(path string) (tileKey, *big.Int, *big.Int, bool) {
+	m := tilePathRegexp.FindStringSubmatch(path)
+	if m == nil {
+		return tileKey{}, nil, nil, false
+	}
+
+	z, err := strconv.Atoi(m[1])
+	if err != nil || z > s.maxZoom {
+		return tileKey{}, nil, nil, false
+	}
+
+	// there are 2^z tiles in a row and in a column
+	limit := big.NewInt(0).Lsh(big.NewInt(1), uint(z))
+	x, _ := big.NewInt(0).SetString(m[2], 10)
+	y, _ := big.NewInt(0).SetString(m[3], 10)
+	if x.Cmp(limit) >= 0 || y.Cmp(limit) >= 0 {
+		return tileKey{}, nil, nil, false
+	}
+
+	return tileKey{z: z, x: x.String(), y: y.String()}, x, y, true
+}
+
+func (s *tileServer) cachePath(t tileKey) string {
+	return filepath.Join(s.cacheDir, strconv.Itoa(t.z), t.x, t.y+".png")
+}
+
+// Get tile from the cache or render it. Requests of the same tile share a single render,
+// a tile nobody waits for anymore is not rendered
+func (s *tileServer) tile(ctx context.Context, t tileKey, x, y *big.Int) ([]byte, error) {
+	if s.cacheDir != "" {
+		if data, err := ioutil.ReadFile(s.cachePath(t)); err == nil {
+			return data, nil
+		}
+	}
+
+	s.mu.Lock()
+	call, ok := s.calls[t]
+	if !ok {
+		if len(s.calls) >= s.queue {
+			s.mu.Unlock()
+			return nil, errTilesBusy
+		}
+
+		call = &tileCall{done: make(chan struct{}), abandoned: make(chan struct{})}
+		s.calls[t] = call
+		go s.render(t, x, y, call)
+	}
+	call.waiters++
+	s.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.data, call.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 && !call.started {
+			close(call.abandoned)
+			delete(s.calls, t)
+		}
+		s.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (s *tileServer) render(t tileKey, x, y *big.Int, call *tileCall) {
+	select {
+	case s.workers <- struct{}{}:
+	case <-call.abandoned:
+		return
+	}
+	defer func() { <-s.workers }()
+
+	s.mu.Lock()
+	if call.waiters == 0 {
+		// abandoned while the worker was acquired
+		s.mu.Unlock()
+		return
+	}
+	call.started = true
+	s.mu.Unlock()
+
+	call.data, call.err = s.renderTile(t, x, y)
+
+	s.mu.Lock()
+	delete(s.calls, t)
+	s.mu.Unlock()
+	close(call.done)
+}
+
+func (s *tileServer) renderTile(t tileKey, x, y *big.Int) ([]byte, error) {
+	state, err := tileState(t.z, x, y, s.size)
+	if err != nil {
+		return nil, err
+	}
+
+	generatorName := s.opts.Generator
+	if generatorName == "float64" && t.z > float64TileMaxZoom {
+		generatorName = "big"
+	}
+	generator, err := newGenerator(generatorName, tileIterations(s.opts.Iterations, t.z))
+	if err != nil {
+		return nil, err
+	}
+
+	colorizer, err := s.levelColorizer(t.z)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, renderImage(nil, generator, colorizer, state, func(float32) {})); err != nil {
+		return nil, err
+	}
+
+	if s.cacheDir != "" {
+		if err := writeFileAtomic(s.cachePath(t), buf.Bytes()); err != nil {
+			log.Printf("tile %d/%s/%s is not cached: %v", t.z, t.x, t.y, err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+var tileIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Mandelbrot set</title>
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<link rel="stylesheet" href="https://unpkg.com/leaflet@1.9.4/dist/leaflet.css">
+<script src="https://unpkg.com/leaflet@1.9.4/dist/leaflet.js"></script>
+<style>html, body, #map { height: 100%; margin: 0; background: #000; }</style>
+</head>
+<body>
+<div id="map"></div>
+<script>
+var map = L.map('map', {crs: L.CRS.Simple, minZoom: 0, maxZoom: {{.MaxZoom}}});
+var size = {{.Size}};
+var bounds = L.latLngBounds(map.unproject([0, size], 0), map.unproject([size, 0], 0));
+L.tileLayer('{z}/{x}/{y}.png', {tileSize: size, noWrap: true, bounds: bounds, maxZoom: {{.MaxZoom}}}).addTo(map);
+map.fitBounds(bounds);
+</script>
+</body>
+</html>
+`))
+
+func (s *tileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = tileIndexTemplate.Execute(w, struct{ Size, MaxZoom int }{s.size, s.maxZoom})
+		return
+	}
+
+	t, x, y, ok := s.parseTile(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := s.tile(r.Context(), t, x, y)
+	switch {
+	case err == errTilesBusy:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case r.Context().Err() != nil:
+		// client is gone
+		return
+	case err != nil:
+		log.Printf("tile %d/%s/%s: %v", t.z, t.x, t.y, err)
+		http.Error(w, "tile rendering failed", http.StatusInternalServerError)
+		return
+	}
+
+	// tiles never change for the same render options
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	_, _ = w.Write(data)
+}
+
+// tiles subcommand: serve slippy map tiles /{z}/{x}/{y}.png and a map page at /
+func tilesCommand(args []string) error {
+	defaultCache := ""
+	if dir, err := os.UserCacheDir(); err == nil {
+		defaultCache = filepath.Join(dir, "mandelbrot", "tiles")
+	}
+
+	fs := flag.NewFlagSet("tiles", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "listen address")
+	size := fs.Int("tile-size", DefaultTileSize, "tile size in pixels")
+	maxZoom := fs.Int("max-zoom", DefaultTileMaxZoom, "deepest zoom level")
+	cacheDir := fs.String("cache", defaultCache, "tiles cache directory, empty to disable caching")
+	workers := fs.Int("workers", runtime.NumCPU(), "maximum number of tiles rendered at once")
+	queue := fs.Int("queue", DefaultTileQueue, "maximum number of tiles rendered or waiting, more requests get 503")
+	opts := newRenderOptions()
+	opts.register(fs)
+	_ = fs.Parse(args)
+
+	if *size <= 0 || *maxZoom < 0 || *workers < 1 || *queue < 1 {
+		return errors.New("tile size, workers and queue must be positive, max zoom must not be negative")
+	}
+
+	server, err := newTileServer(opts, *size, *maxZoom, *cacheDir, *workers, *queue)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Serving tiles at http://%s/", *addr)
+	if server.cacheDir != "" {
+		log.Printf("Caching tiles in %s", server.cacheDir)
+	}
+
+	return http.ListenAndServe(*addr, server)
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"mandelbrot/fractal"
+	"mandelbrot/fractal/mandelbrot"
+	"math"
+	"math/big"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// timelineFile is a keyframe animation. Values omitted in a keyframe are kept from the previous one
+type timelineFile struct {
+	Render    json.RawMessage    `json:"render"` // Render options, the view is the start of the first keyframe
+	Keyframes []timelineKeyframe `json:"keyframes"`
+}
+
+// timelineKeyframe is a keyframe as it is written in the timeline file
+type timelineKeyframe struct {
+	Time       float64  `json:"time"` // Seconds from the animation start
+	CX         string   `json:"cx"`
+	CY         string   `json:"cy"`
+	Zoom       string   `json:"zoom"`
+	Rotation   *float64 `json:"rotation"` // Counterclockwise rotation, degrees
+	Iterations int      `json:"iterations"`
+	Julia      []string `json:"julia"`  // Julia set parameter as [cx, cy], empty list for the Mandelbrot set
+	Offset     *float64 `json:"offset"` // Palette offset, 1 shifts colors by the whole palette
+}
+
+// keyframe holds all the animated values at a time
+type keyframe struct {
+	time           float64
+	state          *State // Center, scale and rotation
+	iterations     int
+	juliaX, juliaY *big.Float // Julia set parameter, nil for the Mandelbrot set
+	offset         float64
+}
+
+// Read timeline file, keyframes must go in time order
+func loadTimeline(path string) (renderOptions, []*keyframe, error) {
+	opts := newRenderOptions()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return opts, nil, errors.Wrap(err, "read timeline file")
+	}
+
+	var file timelineFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return opts, nil, errors.Wrap(err, path)
+	}
+
+	if len(file.Render) > 0 {
+		if err := json.Unmarshal(file.Render, &opts); err != nil {
+			return opts, nil, errors.Wrap(err, "render options")
+		}
+	}
+
+	if len(file.Keyframes) == 0 {
+		return opts, nil, errors.New("timeline has no keyframes")
+	}
+
+	// values of the first keyframe start from the render options
+	cx, cy, zoom := opts.CX, opts.CY, opts.Zoom
+	rotation, offset := 0.0, 0.0
+	iterations := opts.Iterations
+	if iterations <= 0 {
+		iterations = mandelbrot.DefaultIterations
+	}
+	var juliaX, juliaY *big.Float
+
+	ret := make([]*keyframe, 0, len(file.Keyframes))
+	for i, k := range file.Keyframes {
+		if k.Time < 0 || (i > 0 && k.Time <= file.Keyframes[i-1].Time) {
+			return opts, nil, fmt.Errorf("keyframe %d: time must be greater than time of the previous keyframe", i+1)
+		}
+
+		if k.CX != "" {
+			cx = k.CX
+		}
+		if k.CY != "" {
+			cy = k.CY
+		}
+		if k.Zoom != "" {
+			zoom = k.Zoom
+		}
+		if k.Rotation != nil {
+			rotation = *k.Rotation
+		}
+		if k.Iterations > 0 {
+			iterations = k.Iterations
+		}
+		if k.Offset != nil {
+			offset = *k.Offset
+		}
+
+		switch {
+		case k.Julia == nil:
+		case len(k.Julia) == 0:
+			juliaX, juliaY = nil, nil
+		case len(k.Julia) == 2:
+			juliaX, juliaY, err = parseJulia(k.Julia[0], k.Julia[1])
+			if err != nil {
+				return opts, nil, errors.Wrapf(err, "keyframe %d", i+1)
+			}
+		default:
+			return opts, nil, fmt.Errorf("keyframe %d: julia parameter must be [cx, cy]", i+1)
+		}
+
+		state, err := NewStateView(cx, cy, zoom, opts.Width, opts.Height)
+		if err != nil {
+			return opts, nil, errors.Wrapf(err, "keyframe %d", i+1)
+		}
+		state.SetRotation(rotation * math.Pi / 180)
+
+		ret = append(ret, &keyframe{
+			time:       k.Time,
+			state:      state,
+			iterations: iterations,
+			juliaX:     juliaX,
+			juliaY:     juliaY,
+			offset:     offset,
+		})
+	}
+
+	return opts, ret, nil
+}
+
+func parseJulia(cx, cy string) (*big.Float, *big.Float, error) {
+	x, _, err := big.ParseFloat(cx, 10, DefaultFloatsPrecision, big.ToNearestEven)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid julia cx %q: %v", cx, err)
+	}
+
+	y, _, err := big.ParseFloat(cy, 10, DefaultFloatsPrecision, big.ToNearestEven)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid julia cy %q: %v", cy, err)
+	}
+
+	return x, y, nil
+}
+
+// timeline interpolates keyframes. Zoom is interpolated in log space, so magnification
+// changes at a constant rate. Center follows a monotone cubic spline, other values are linear
+type timeline struct {
+	keyframes            []*keyframe
+	tangentsX, tangentsY []*big.Float // Spline tangents at keyframes
+}
+
+func newTimeline(keyframes []*keyframe) *timeline {
+	ret := &timeline{
+		keyframes: keyframes,
+		tangentsX: make([]*big.Float, len(keyframes)),
+		tangentsY: make([]*big.Float, len(keyframes)),
+	}
+
+	if len(keyframes) < 2 {
+		return ret
+	}
+
+	deltas := func(get func(s *State) *big.Float) []*big.Float {
+		ret := make([]*big.Float, len(keyframes)-1)
+		for i := range ret {
+			ret[i] = big.NewFloat(0).SetPrec(DefaultFloatsPrecision).Sub(get(keyframes[i+1].state), get(keyframes[i].state))
+		}
+		return ret
+	}
+	dx := deltas((*State).GetCX)
+	dy := deltas((*State).GetCY)
+
+	// ends of the path are linear, so a single segment keeps its target in place like the zoom sequence
+	last := len(keyframes) - 1
+	ret.tangentsX[0], ret.tangentsY[0] = dx[0], dy[0]
+	ret.tangentsX[last], ret.tangentsY[last] = dx[last-1], dy[last-1]
+	for i := 1; i < last; i++ {
+		ret.tangentsX[i] = splineTangent(dx[i-1], dx[i])
+		ret.tangentsY[i] = splineTangent(dy[i-1], dy[i])
+	}
+
+	return ret
+}
+
+// Tangent of the monotone cubic spline between segments of unit length.
+// It is zero at extremes and limited by the smaller segment, so the path never overshoots keyframes.
+// This matters for deep zooms, where the next segment is tiny compared to the previous one
+func splineTangent(before, after *big.Float) *big.Float {
+	ret := big.NewFloat(0).SetPrec(before.Prec())
+	if before.Sign()*after.Sign() <= 0 {
+		return ret
+	}
+
+	ret.Add(before, after)
+	ret.Quo(ret, big.NewFloat(2))
+
+	limit := big.NewFloat(0).SetPrec(before.Prec()).Abs(before)
+	if absAfter := big.NewFloat(0).SetPrec(after.Prec()).Abs(after); absAfter.Cmp(limit) < 0 {
+		limit = absAfter
+	}
+	limit.Mul(limit, big.NewFloat(3))
+
+	if big.NewFloat(0).Abs(ret).Cmp(limit) > 0 {
+		ret.Set(limit)
+		if before.Sign() < 0 {
+			ret.Neg(ret)
+		}
+	}
+
+	return ret
+}
+
+// Duration returns time of the last keyframe
+func (tl *timeline) Duration() float64 {
+	return tl.keyframes[len(tl.keyframes)-1].time
+}
+
+// Progress of the scale change in range [0, 1] when scale goes through the given number
+// of doublings in log space and the time fraction f is passed. Moving the center at this rate
+// keeps the point the view zooms into fixed on the screen. Scale difference may be huge,
+// so the formula is arranged to avoid overflow
+func scaleProgress(f, doublings float64) float64 {
+	if math.Abs(doublings) < 1e-9 {
+		return f
+	}
+
+	if doublings < 0 {
+		return math.Expm1(f*doublings*math.Ln2) / math.Expm1(doublings*math.Ln2)
+	}
+
+	return math.Exp2((f-1)*doublings) * math.Expm1(-f*doublings*math.Ln2) / math.Expm1(-doublings*math.Ln2)
+}
+
+// At returns values interpolated at the given time
+func (tl *timeline) At(t float64) *keyframe {
+	first, last := tl.keyframes[0], tl.keyframes[len(tl.keyframes)-1]
+	if t <= first.time {
+		return first
+	}
+	if t >= last.time {
+		return last
+	}
+
+	i := 0
+	for tl.keyframes[i+1].time <= t {
+		i++
+	}
+	k0, k1 := tl.keyframes[i], tl.keyframes[i+1]
+	f := (t - k0.time) / (k1.time - k0.time)
+
+	doublings := log2Big(k1.state.GetScale()) - log2Big(k0.state.GetScale())
+	scale := mulExp2Big(k0.state.GetScale(), f*doublings)
+
+	// the spline goes by the scale progress instead of time, so the center
+	// moves as fast as the view shrinks and stays at the keyframe target
+	s := scaleProgress(f, doublings)
+	h01 := s * s * (3 - 2*s)
+	h10 := s * (s - 1) * (s - 1)
+	h11 := s * s * (s - 1)
+
+	hermite := func(p0, p1, m0, m1 *big.Float) *big.Float {
+		// p0 + h01*(p1 - p0) + h10*m0 + h11*m1
+		ret := big.NewFloat(0).SetPrec(p0.Prec()).Sub(p1, p0)
+		ret.Mul(ret, big.NewFloat(h01))
+		ret.Add(ret, big.NewFloat(0).SetPrec(p0.Prec()).Mul(m0, big.NewFloat(h10)))
+		ret.Add(ret, big.NewFloat(0).SetPrec(p0.Prec()).Mul(m1, big.NewFloat(h11)))
+		return ret.Add(ret, p0)
+	}
+	cx := hermite(k0.state.GetCX(), k1.state.GetCX(), tl.tangentsX[i], tl.tangentsX[i+1])
+	cy := hermite(k0.state.GetCY(), k1.state.GetCY(), tl.tangentsY[i], tl.tangentsY[i+1])
+
+	state, _ := NewStateScale(cx, cy, scale,
+		int(k0.state.GetScreenWidth()), int(k0.state.GetScreenHeight()))
+	state.SetRotation(k0.state.GetRotation() + (k1.state.GetRotation()-k0.state.GetRotation())*f)
+
+	ret := &keyframe{
+		time:       t,
+		state:      state,
+		iterations: int(math.Round(float64(k0.iterations) + float64(k1.iterations-k0.iterations)*f)),
+		juliaX:     k0.juliaX,
+		juliaY:     k0.juliaY,
+		offset:     k0.offset + (k1.offset-k0.offset)*f,
+	}
+
+	// switching between the Mandelbrot and a Julia set can not be smooth, it happens at the next keyframe
+	if k0.juliaX != nil && k1.juliaX != nil {
+		ret.juliaX = lerpBig(k0.juliaX, k1.juliaX, f)
+		ret.juliaY = lerpBig(k0.juliaY, k1.juliaY, f)
+	}
+
+	return ret
+}
+
+// animate subcommand: render frames of a keyframe timeline
+func animateCommand(args []string) error {
+	fs := flag.NewFlagSet("animate", flag.ExitOnError)
+	frameOpts := newFrameOptions()
+	frameOpts.register(fs)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: %s animate [options] <timeline.json>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if frameOpts.FPS <= 0 {
+		return errors.New("fps must be positive")
+	}
+
+	opts, keyframes, err := loadTimeline(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// generator is created for every frame, because the iterations limit is animated
+	_, colorizer, err := opts.build()
+	if err != nil {
+		return err
+	}
+
+	tl := newTimeline(keyframes)
+	frames := int(math.Floor(tl.Duration()*frameOpts.FPS+1e-9)) + 1
+
+	return frameOpts.writeFrames(opts.Width, opts.Height, frames, func(frame int) (*image.RGBA, error) {
+		values := tl.At(float64(frame) / frameOpts.FPS)
+
+		generator, err := newGenerator(opts.Generator, values.iterations)
+		if err != nil {
+			return nil, err
+		}
+
+		if values.juliaX != nil {
+			julia, ok := generator.(fractal.JuliaSetter)
+			if !ok {
+				return nil, fmt.Errorf("generator %s does not support julia sets", opts.Generator)
+			}
+			julia.SetJulia(values.juliaX, values.juliaY)
+		}
+
+		colorizer.SetOffset(values.offset)
+
+		return renderImage(nil, generator, colorizer, values.state, func(float32) {}), nil
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestScaleProgress(t *testing.T) {
+	tests := []struct {
+		f, doublings float64
+		expected     float64
+	}{
+		{0, 0, 0},
+		{1, 0, 1},
+		{0.25, 0, 0.25},
+		{0, math.Copysign(0, -1), 0},
+		{1, math.Copysign(0, -1), 1},
+		{0.5, math.Copysign(0, -1), 0.5},
+		{0, 1, 0},
+		{1, 1, 1},
+		{0.5, 1, math.Sqrt2 - 1},
+		{0, -1, 0},
+		{1, -1, 1},
+		{0.5, -1, (math.Sqrt2/2 - 1) / -0.5},
+		{0, 1e3, 0},
+		{1, 1e3, 1},
+		{0.5, 1e3, math.Exp2(-500)},
+		{0, -1e3, 0},
+		{1, -1e3, 1},
+		{0.5, -1e3, 1 - math.Exp2(-500)},
+	}
+
+	for _, test := range tests {
+		got := scaleProgress(test.f, test.doublings)
+		if math.IsNaN(got) || math.Abs(got-test.expected) > 1e-12 {
+			t.Errorf("scaleProgress(%g, %g) = %g, expected %g", test.f, test.doublings, got, test.expected)
+		}
+	}
+}
+
+func TestSplineTangent(t *testing.T) {
+	tests := []struct {
+		before, after float64
+		expected      float64
+	}{
+		{1, 1, 1},
+		{-1, -1, -1},
+		{1, 3, 2},
+		{1, -1, 0},
+		{0, 1, 0},
+		{1, 0, 0},
+		// the tangent is limited by the tiny segment, so the path doesn't overshoot it
+		{1, 1e-6, 3e-6},
+		{-1, -1e-6, -3e-6},
+		{1e-6, 1, 3e-6},
+	}
+
+	for _, test := range tests {
+		got, _ := splineTangent(big.NewFloat(test.before), big.NewFloat(test.after)).Float64()
+		if math.Abs(got-test.expected) > 1e-15 {
+			t.Errorf("splineTangent(%g, %g) = %g, expected %g", test.before, test.after, got, test.expected)
+		}
+	}
+}
+
+func TestTimelineAt(t *testing.T) {
+	// the last segment is tiny compared to the first one, like at the end of a deep zoom
+	views := []struct {
+		time     float64
+		cx, zoom string
+	}{
+		{0, "-0.5", "1"},
+		{1, "-0.75", "1e3"},
+		{2, "-0.750001", "1e9"},
+	}
+
+	keyframes := make([]*keyframe, len(views))
+	for i, v := range views {
+		state, err := NewStateView(v.cx, "0.1", v.zoom, 64, 48)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyframes[i] = &keyframe{time: v.time, state: state, iterations: 100}
+	}
+	tl := newTimeline(keyframes)
+
+	// keyframes are passed exactly
+	for i, k := range keyframes {
+		got := tl.At(k.time).state
+		if got.GetCX().Cmp(k.state.GetCX()) != 0 || got.GetScale().Cmp(k.state.GetScale()) != 0 {
+			t.Errorf("keyframe %d: view at %g is %s, %s, expected %s, %s", i, k.time,
+				got.GetCX().Text('g', 10), got.GetScale().Text('g', 10),
+				k.state.GetCX().Text('g', 10), k.state.GetScale().Text('g', 10))
+		}
+	}
+
+	// and the center goes between keyframes without overshooting any of them
+	for i := 0; i < len(keyframes)-1; i++ {
+		from, to := keyframes[i].state.GetCX(), keyframes[i+1].state.GetCX()
+		prev := from
+		for step := 1; step < 100; step++ {
+			cx := tl.At(keyframes[i].time + float64(step)/100).state.GetCX()
+			if cx.Cmp(prev) > 0 || cx.Cmp(to) < 0 {
+				t.Fatalf("segment %d: center %s at step %d is out of the way from %s to %s", i,
+					cx.Text('g', 10), step, prev.Text('g', 10), to.Text('g', 10))
+			}
+			prev = cx
+		}
+	}
+}
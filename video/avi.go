@@ -0,0 +1,207 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+// Offsets of header fields patched when the video is finished
+const (
+	aviRIFFSizeOffset        = 4
+	aviTotalFramesOffset     = 48
+	aviMaxBufferOffset       = 60
+	aviStreamLengthOffset    = 140
+	aviStreamMaxBufferOffset = 144
+	aviMoviSizeOffset        = 216
+	aviMoviOffset            = 220 // Position of 'movi' list type, index offsets are relative to it
+	aviFlagHasIndex          = 0x10
+	aviIndexFlagKeyframe     = 0x10
+	aviMaxRIFFSize           = math.MaxUint32
+	aviHeaderSize            = 224
+	aviIndexEntrySize        = 16
+	aviChunkHeaderSize       = 8
+)
+
+// AVIWriter writes Motion-JPEG AVI file. Frames are written as they come,
+// only the index of 16 bytes per frame is kept in memory.
+// Header sizes are patched on Close, so the writer must be seekable
+type AVIWriter struct {
+	w             io.WriteSeeker
+	width, height int
+	quality       int
+
+	offset    int64  // Current position relative to the file start
+	maxFrame  uint32 // Size of the largest frame
+	index     []byte // idx1 entries
+	frames    uint32
+	frameData bytes.Buffer
+}
+
+func NewAVIWriter(w io.WriteSeeker, width, height int, fps float64, quality int) (*AVIWriter, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid video size %dx%d", width, height)
+	}
+
+	ret := &AVIWriter{
+		w:       w,
+		width:   width,
+		height:  height,
+		quality: quality,
+	}
+
+	rateNum, rateDen := frameRate(fps)
+
+	header := &bytes.Buffer{}
+	le := func(values ...interface{}) {
+		for _, v := range values {
+			_ = binary.Write(header, binary.LittleEndian, v)
+		}
+	}
+
+	header.WriteString("RIFF")
+	le(uint32(0)) // patched on Close
+	header.WriteString("AVI ")
+
+	header.WriteString("LIST")
+	le(uint32(4 + 8 + 56 + 8 + 4 + 8 + 56 + 8 + 40))
+	header.WriteString("hdrl")
+
+	header.WriteString("avih")
+	le(uint32(56),
+		uint32(math.Round(1e6*float64(rateDen)/float64(rateNum))), // microseconds per frame
+		uint32(0),               // max bytes per second
+		uint32(0),               // padding granularity
+		uint32(aviFlagHasIndex), // flags
+		uint32(0),               // total frames, patched on Close
+		uint32(0),               // initial frames
+		uint32(1),               // streams
+		uint32(0),               // suggested buffer size, patched on Close
+		uint32(width), uint32(height),
+		[4]uint32{})
+
+	header.WriteString("LIST")
+	le(uint32(4 + 8 + 56 + 8 + 40))
+	header.WriteString("strl")
+
+	header.WriteString("strh")
+	le(uint32(56))
+	header.WriteString("vidsMJPG")
+	le(uint32(0), // flags
+		uint16(0), uint16(0), // priority, language
+		uint32(0), // initial frames
+		uint32(rateDen), uint32(rateNum),
+		uint32(0), // start
+		uint32(0), // length, patched on Close
+		uint32(0), // suggested buffer size, patched on Close
+		int32(-1), // quality
+		uint32(0), // sample size
+		[4]int16{0, 0, int16(width), int16(height)})
+
+	header.WriteString("strf")
+	le(uint32(40),
+		uint32(40), int32(width), int32(height),
+		uint16(1), uint16(24))
+	header.WriteString("MJPG")
+	le(uint32(width*height*3), int32(0), int32(0), uint32(0), uint32(0))
+
+	header.WriteString("LIST")
+	le(uint32(0)) // patched on Close
+	header.WriteString("movi")
+
+	if header.Len() != aviHeaderSize {
+		return nil, fmt.Errorf("internal error: avi header size %d", header.Len())
+	}
+
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return nil, err
+	}
+	ret.offset = aviHeaderSize
+
+	return ret, nil
+}
+
+func (w *AVIWriter) WriteFrame(img image.Image) error {
+	if err := checkSize(img, w.width, w.height); err != nil {
+		return err
+	}
+
+	w.frameData.Reset()
+	if err := jpeg.Encode(&w.frameData, img, &jpeg.Options{Quality: w.quality}); err != nil {
+		return err
+	}
+
+	size := uint32(w.frameData.Len())
+	padded := int64(size) + int64(size)%2
+	end := w.offset + aviChunkHeaderSize + padded + int64(len(w.index)) + aviIndexEntrySize*2 + aviChunkHeaderSize
+	if end > aviMaxRIFFSize {
+		return fmt.Errorf("avi file size limit of 4GB is reached at frame %d", w.frames)
+	}
+
+	chunk := make([]byte, aviChunkHeaderSize, aviChunkHeaderSize+padded)
+	copy(chunk, "00dc")
+	binary.LittleEndian.PutUint32(chunk[4:], size)
+	chunk = append(chunk, w.frameData.Bytes()...)
+	if size%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	if _, err := w.w.Write(chunk); err != nil {
+		return err
+	}
+
+	entry := make([]byte, aviIndexEntrySize)
+	copy(entry, "00dc")
+	binary.LittleEndian.PutUint32(entry[4:], aviIndexFlagKeyframe)
+	binary.LittleEndian.PutUint32(entry[8:], uint32(w.offset-aviMoviOffset))
+	binary.LittleEndian.PutUint32(entry[12:], size)
+	w.index = append(w.index, entry...)
+
+	w.offset += int64(len(chunk))
+	w.frames++
+	if size > w.maxFrame {
+		w.maxFrame = size
+	}
+
+	return nil
+}
+
+// Close writes the index and patches header sizes
+func (w *AVIWriter) Close() error {
+	moviSize := uint32(w.offset - aviMoviOffset)
+
+	idx := make([]byte, aviChunkHeaderSize, aviChunkHeaderSize+len(w.index))
+	copy(idx, "idx1")
+	binary.LittleEndian.PutUint32(idx[4:], uint32(len(w.index)))
+	idx = append(idx, w.index...)
+	if _, err := w.w.Write(idx); err != nil {
+		return err
+	}
+	riffSize := uint32(w.offset + int64(len(idx)) - 8)
+
+	for _, patch := range []struct {
+		offset int64
+		value  uint32
+	}{
+		{aviRIFFSizeOffset, riffSize},
+		{aviTotalFramesOffset, w.frames},
+		{aviMaxBufferOffset, w.maxFrame},
+		{aviStreamLengthOffset, w.frames},
+		{aviStreamMaxBufferOffset, w.maxFrame},
+		{aviMoviSizeOffset, moviSize},
+	} {
+		if _, err := w.w.Seek(patch.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if err := binary.Write(w.w, binary.LittleEndian, patch.value); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.w.Seek(0, io.SeekEnd)
+
+	return err
+}
@@ -0,0 +1,116 @@
+package video
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"mandelbrot/palette"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GIFOptions define palette quantization and timing of animated GIF
+type GIFOptions struct {
+	Colors    int               // Palette size, up to 256
+	Global    bool              // Use one palette optimized for all the frames instead of a palette per frame
+	Dither    bool              // Use Floyd-Steinberg dithering
+	Quantizer palette.Quantizer // Palette quantization algorithm
+	Delay     time.Duration     // Delay between frames, GIF stores it in 1/100 of a second
+
+	// 0 loops forever, -1 shows the frames once, other values repeat the animation LoopCount more times
+	LoopCount int
+}
+
+// GIFWriter writes animated GIF. The format has no streaming encoder, so frames are kept in memory:
+// quantized frames of one byte per pixel, or RGBA frames when a global palette is built on Close
+type GIFWriter struct {
+	w             io.Writer
+	width, height int
+	opts          GIFOptions
+
+	anim   gif.GIF
+	frames []image.Image // Frames waiting for the global palette
+}
+
+func NewGIFWriter(w io.Writer, width, height int, opts GIFOptions) (*GIFWriter, error) {
+	if opts.Colors < 2 || opts.Colors > 256 {
+		return nil, errors.New("gif palette must have from 2 to 256 colors")
+	}
+
+	ret := &GIFWriter{
+		w:      w,
+		width:  width,
+		height: height,
+		opts:   opts,
+	}
+	ret.anim.LoopCount = opts.LoopCount
+	ret.anim.Config = image.Config{Width: width, Height: height}
+
+	return ret, nil
+}
+
+func (w *GIFWriter) WriteFrame(img image.Image) error {
+	if err := checkSize(img, w.width, w.height); err != nil {
+		return err
+	}
+
+	if w.opts.Global {
+		// the frame may be reused by the caller
+		w.frames = append(w.frames, copyRGBA(img))
+		return nil
+	}
+
+	pal, err := palette.Quantize([]image.Image{img}, w.opts.Colors, w.opts.Quantizer)
+	if err != nil {
+		return err
+	}
+
+	w.addFrame(img, pal)
+
+	return nil
+}
+
+// Close quantizes frames waiting for the global palette and writes the GIF
+func (w *GIFWriter) Close() error {
+	if w.opts.Global && len(w.frames) > 0 {
+		pal, err := palette.Quantize(w.frames, w.opts.Colors, w.opts.Quantizer)
+		if err != nil {
+			return err
+		}
+
+		for _, img := range w.frames {
+			w.addFrame(img, pal)
+		}
+		w.frames = nil
+	}
+
+	if len(w.anim.Image) == 0 {
+		return errors.New("no frames to write")
+	}
+
+	return gif.EncodeAll(w.w, &w.anim)
+}
+
+func (w *GIFWriter) addFrame(img image.Image, pal color.Palette) {
+	paletted := image.NewPaletted(image.Rect(0, 0, w.width, w.height), pal)
+
+	var drawer draw.Drawer = draw.Src
+	if w.opts.Dither {
+		drawer = draw.FloydSteinberg
+	}
+	drawer.Draw(paletted, paletted.Rect, img, img.Bounds().Min)
+
+	w.anim.Image = append(w.anim.Image, paletted)
+	w.anim.Delay = append(w.anim.Delay, int(w.opts.Delay/(10*time.Millisecond)))
+	w.anim.Disposal = append(w.anim.Disposal, gif.DisposalNone)
+}
+
+func copyRGBA(img image.Image) *image.RGBA {
+	ret := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(ret, ret.Rect, img, img.Bounds().Min, draw.Src)
+
+	return ret
+}
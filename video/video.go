@@ -0,0 +1,99 @@
+// Package video writes animation frames into video containers as they are rendered
+package video
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Writer streams frames into a video container
+type Writer interface {
+	// WriteFrame appends a frame, all the frames must have the size given on creation
+	WriteFrame(img image.Image) error
+
+	// Close finishes the container. The underlying writer is not closed
+	Close() error
+}
+
+// Convert image into RGBA unless it is RGBA already
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+
+	ret := image.NewRGBA(img.Bounds())
+	draw.Draw(ret, ret.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	return ret
+}
+
+func checkSize(img image.Image, width, height int) error {
+	size := img.Bounds().Size()
+	if size.X != width || size.Y != height {
+		return fmt.Errorf("frame size %dx%d differs from video size %dx%d", size.X, size.Y, width, height)
+	}
+
+	return nil
+}
+
+// IsVideoPath reports whether the file extension is a supported video container
+func IsVideoPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".y4m", ".avi":
+		return true
+	default:
+		return false
+	}
+}
+
+// fileWriter closes the file after the container is finished
+type fileWriter struct {
+	Writer
+	f *os.File
+}
+
+func (w *fileWriter) Close() error {
+	err := w.Writer.Close()
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Create creates video file, container is selected by the file extension: .y4m or .avi.
+// "-" writes YUV4MPEG2 to stdout
+func Create(path string, width, height int, fps float64, quality int) (Writer, error) {
+	if path == "-" {
+		return NewY4MWriter(os.Stdout, width, height, fps)
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".y4m" && ext != ".avi" {
+		return nil, fmt.Errorf("unknown video format: %s", path)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "create video file")
+	}
+
+	var w Writer
+	if ext == ".avi" {
+		w, err = NewAVIWriter(f, width, height, fps, quality)
+	} else {
+		w, err = NewY4MWriter(f, width, height, fps)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &fileWriter{Writer: w, f: f}, nil
+}
@@ -0,0 +1,177 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"io/ioutil"
+	"mandelbrot/palette"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFrame(width, height int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+
+	return img
+}
+
+func TestY4MWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewY4MWriter(buf, 5, 3, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := w.WriteFrame(testFrame(5, 3, color.RGBA{R: 255, A: 255})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteFrame(testFrame(4, 3, color.RGBA{})); err == nil {
+		t.Error("error expected for frame of different size")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.String()
+	header := data[:strings.Index(data, "\n")+1]
+	if !strings.HasPrefix(header, "YUV4MPEG2 W5 H3 F30:1 ") {
+		t.Errorf("unexpected header %q", header)
+	}
+
+	// luma plane plus two 3x2 chroma planes per frame
+	frameSize := len("FRAME\n") + 5*3 + 2*3*2
+	if len(data) != len(header)+2*frameSize {
+		t.Errorf("stream size %d, expected %d", len(data), len(header)+2*frameSize)
+	}
+}
+
+func TestAVIWriter(t *testing.T) {
+	f, err := ioutil.TempFile("", "video*.avi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w, err := NewAVIWriter(f, 16, 8, 25, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.WriteFrame(testFrame(16, 8, color.RGBA{G: uint8(100 * i), A: 255})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	le := binary.LittleEndian
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "AVI " {
+		t.Fatal("not a RIFF AVI file")
+	}
+	if int(le.Uint32(data[4:])) != len(data)-8 {
+		t.Errorf("RIFF size %d, expected %d", le.Uint32(data[4:]), len(data)-8)
+	}
+	if le.Uint32(data[aviTotalFramesOffset:]) != 3 || le.Uint32(data[aviStreamLengthOffset:]) != 3 {
+		t.Error("frames count is not patched")
+	}
+
+	// walk top level lists and chunks of the RIFF
+	chunks := map[string][]byte{}
+	for pos := 12; pos < len(data); {
+		id, size := string(data[pos:pos+4]), int(le.Uint32(data[pos+4:]))
+		if id == "LIST" {
+			id = string(data[pos+8 : pos+12])
+		}
+		chunks[id] = data[pos+8 : pos+8+size]
+		pos += 8 + size + size%2
+	}
+
+	for _, id := range []string{"hdrl", "movi", "idx1"} {
+		if _, ok := chunks[id]; !ok {
+			t.Fatalf("%s is missing", id)
+		}
+	}
+
+	idx := chunks["idx1"]
+	if len(idx) != 3*aviIndexEntrySize {
+		t.Fatalf("index size %d", len(idx))
+	}
+
+	// the last frame is found by the index and decoded
+	entry := idx[2*aviIndexEntrySize:]
+	offset := aviMoviOffset + int(le.Uint32(entry[8:]))
+	size := int(le.Uint32(entry[12:]))
+	if string(data[offset:offset+4]) != "00dc" {
+		t.Fatalf("index points to %q", data[offset:offset+4])
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data[offset+8 : offset+8+size]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, g, _, _ := img.At(8, 4).RGBA(); g>>8 < 190 {
+		t.Errorf("unexpected frame color %v", img.At(8, 4))
+	}
+}
+
+func TestGIFWriter(t *testing.T) {
+	for _, global := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		w, err := NewGIFWriter(buf, 8, 4, GIFOptions{
+			Colors:    16,
+			Global:    global,
+			Dither:    true,
+			Quantizer: palette.QuantizerMedianCut,
+			Delay:     50 * time.Millisecond,
+			LoopCount: 2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frame := testFrame(8, 4, color.RGBA{R: 200, A: 255})
+		for i := 0; i < 3; i++ {
+			frame.SetRGBA(i, 0, color.RGBA{B: 255, A: 255})
+			if err := w.WriteFrame(frame); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		anim, err := gif.DecodeAll(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(anim.Image) != 3 || anim.Delay[0] != 5 || anim.LoopCount != 2 {
+			t.Errorf("global %v: %d frames, delay %d, loop count %d", global, len(anim.Image), anim.Delay[0], anim.LoopCount)
+		}
+
+		// frames are copied, so changes of the reused frame must not leak into earlier ones
+		if _, _, b, _ := anim.Image[0].At(1, 0).RGBA(); b>>8 > 128 {
+			t.Errorf("global %v: frame 0 has pixel of a later frame", global)
+		}
+		if r, _, _, _ := anim.Image[2].At(7, 3).RGBA(); r>>8 < 180 {
+			t.Errorf("global %v: unexpected color %v", global, anim.Image[2].At(7, 3))
+		}
+	}
+}
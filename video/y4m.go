@@ -0,0 +1,106 @@
+package video
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// Y4MWriter writes uncompressed YUV4MPEG2 stream with 4:2:0 chroma subsampling,
+// the format is read by most encoders from a pipe
+type Y4MWriter struct {
+	w             *bufio.Writer
+	width, height int
+
+	y, cb, cr []uint8 // Frame planes, reused between frames
+}
+
+func NewY4MWriter(w io.Writer, width, height int, fps float64) (*Y4MWriter, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid video size %dx%d", width, height)
+	}
+
+	rateNum, rateDen := frameRate(fps)
+
+	ret := &Y4MWriter{
+		w:      bufio.NewWriter(w),
+		width:  width,
+		height: height,
+		y:      make([]uint8, width*height),
+		cb:     make([]uint8, chromaSize(width)*chromaSize(height)),
+		cr:     make([]uint8, chromaSize(width)*chromaSize(height)),
+	}
+
+	// components are full range as produced by color.RGBToYCbCr
+	_, err := fmt.Fprintf(ret.w, "YUV4MPEG2 W%d H%d F%d:%d Ip A1:1 C420jpeg XCOLORRANGE=FULL\n",
+		width, height, rateNum, rateDen)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (w *Y4MWriter) WriteFrame(img image.Image) error {
+	if err := checkSize(img, w.width, w.height); err != nil {
+		return err
+	}
+
+	rgba := toRGBA(img)
+	cw := chromaSize(w.width)
+
+	// chroma of 2x2 pixel blocks is averaged
+	cbSum := make([]int, len(w.cb))
+	crSum := make([]int, len(w.cr))
+	count := make([]int, len(w.cb))
+
+	for y := 0; y < w.height; y++ {
+		for x := 0; x < w.width; x++ {
+			c := rgba.RGBAAt(rgba.Rect.Min.X+x, rgba.Rect.Min.Y+y)
+			yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+			w.y[y*w.width+x] = yy
+
+			i := (y/2)*cw + x/2
+			cbSum[i] += int(cb)
+			crSum[i] += int(cr)
+			count[i]++
+		}
+	}
+
+	for i := range w.cb {
+		w.cb[i] = uint8((cbSum[i] + count[i]/2) / count[i])
+		w.cr[i] = uint8((crSum[i] + count[i]/2) / count[i])
+	}
+
+	if _, err := w.w.WriteString("FRAME\n"); err != nil {
+		return err
+	}
+	for _, plane := range [][]uint8{w.y, w.cb, w.cr} {
+		if _, err := w.w.Write(plane); err != nil {
+			return err
+		}
+	}
+
+	// frames are streamed, so a reader gets every frame as soon as it is written
+	return w.w.Flush()
+}
+
+func (w *Y4MWriter) Close() error {
+	return w.w.Flush()
+}
+
+func chromaSize(size int) int {
+	return (size + 1) / 2
+}
+
+// Convert frames per second into a rational number
+func frameRate(fps float64) (int, int) {
+	if fps == math.Trunc(fps) {
+		return int(fps), 1
+	}
+
+	return int(math.Round(fps * 1000)), 1000
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"math/big"
 )
 
@@ -32,16 +33,25 @@ func (z *ZoomerSimple) ZoomAt(
 	normX := ((x / s.GetScreenWidth()) - 0.5) * 2
 	normY := ((y / s.GetScreenHeight()) - 0.5) * 2
 
+	// Physical offsets of the point from the center are rotated with the view like in generators.
+	// Offset along an axis is the sum of both offsets before rotation scaled by the physical sizes
+	sin, cos := math.Sincos(s.GetRotation())
+	offset := func(prec uint, fromX, fromY float64) *big.Float {
+		x := big.NewFloat(fromX * normX / 2).SetPrec(prec)
+		x.Mul(x, s.GetPhysicalWidth())
+		y := big.NewFloat(fromY * normY / 2).SetPrec(prec)
+		y.Mul(y, s.GetPhysicalHeight())
+		return x.Add(x, y)
+	}
+
 	// Calculate new center coordinates: x
 	cx, cy, scale := s.GetCX(), s.GetCY(), s.GetScale()
-	newX := big.NewFloat(normX).SetPrec(cx.Prec())
-	newX.Mul(newX, s.GetScale())
+	newX := offset(cx.Prec(), cos, -sin)
 	newX.Add(newX, cx)
 	cx.Copy(newX)
 
 	// Calculate new center coordinates: y
-	newY := big.NewFloat(normY).SetPrec(cy.Prec())
-	newY.Mul(newY, s.GetScale())
+	newY := offset(cy.Prec(), sin, cos)
 	newY.Add(newY, cy)
 	cy.Copy(newY)
 
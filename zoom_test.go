@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestZoomAtRotated(t *testing.T) {
+	for _, rotation := range []float64{0, 0.5, -2} {
+		s := NewState()
+		s.SetRotation(rotation)
+
+		// the point of the pixel like generators compute it
+		x, y := 500.0, 100.0
+		cx, _ := s.GetCX().Float64()
+		cy, _ := s.GetCY().Float64()
+		pw, _ := s.GetPhysicalWidth().Float64()
+		ph, _ := s.GetPhysicalHeight().Float64()
+		dx := x*pw/s.GetScreenWidth() - pw/2
+		dy := y*ph/s.GetScreenHeight() - ph/2
+		sin, cos := math.Sincos(rotation)
+		px, py := cx+dx*cos-dy*sin, cy+dx*sin+dy*cos
+
+		NewZoomerSimple().ZoomAt(s, x, y, ZoomDirectionIn)
+
+		// the zoom is centered at the point
+		cx, _ = s.GetCX().Float64()
+		cy, _ = s.GetCY().Float64()
+		if math.Abs(cx-px) > 1e-12 || math.Abs(cy-py) > 1e-12 {
+			t.Errorf("rotation %g: center is %g, %g, expected %g, %g", rotation, cx, cy, px, py)
+		}
+	}
+}